@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// OnResponse, when set, is called with the raw body of every response.
+	OnResponse func(path string, body []byte)
+}
+
+func NewClient(host string) *Client {
+	return &Client{BaseURL: fmt.Sprintf("http://%s:%d", host, Port), HTTPClient: http.DefaultClient}
+}
+
+func (c *Client) do(ctx context.Context, method, path, contentType string, body io.Reader, target interface{}) error {
+	req, err := http.NewRequest(method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if c.OnResponse != nil {
+		c.OnResponse(path, data)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		e := &Error{Path: path, StatusCode: res.StatusCode, Message: string(data)}
+		errorResponse := ErrorResponse{}
+		if json.Unmarshal(data, &errorResponse) == nil && errorResponse.Error.Message != "" {
+			e.Code = errorResponse.Error.Code
+			e.Message = errorResponse.Error.Message
+		}
+		return e
+	}
+	return json.Unmarshal(data, target)
+}
+
+func (c *Client) get(ctx context.Context, path string, target interface{}) error {
+	return c.do(ctx, http.MethodGet, path, "", nil, target)
+}
+
+func (c *Client) postForm(ctx context.Context, path string, data url.Values, target interface{}) error {
+	return c.do(ctx, http.MethodPost, path, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()), target)
+}
+
+func (c *Client) postJSON(ctx context.Context, path string, data interface{}, target interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, path, "application/json", bytes.NewReader(body), target)
+}
+
+func (c *Client) Version(ctx context.Context) (*Version, error) {
+	target := &Version{}
+	err := c.get(ctx, PathVersion, target)
+	return target, err
+}
+
+func (c *Client) Health(ctx context.Context) error {
+	return c.get(ctx, PathHealth, &Health{})
+}
+
+func (c *Client) GatherCandidates(ctx context.Context, opts GatherOptions) ([]*Candidate, error) {
+	target := GatherCandidatesResponse{}
+	path := PathGatherCandidates
+	if query := opts.values().Encode(); query != "" {
+		path += "?" + query
+	}
+	err := c.get(ctx, path, &target)
+	return target.Candidates, err
+}
+
+func (c *Client) Ping(ctx context.Context, ip string, times int) ([]time.Duration, error) {
+	target := PingResponse{}
+	err := c.postForm(ctx, PathPing, url.Values{"ip": {ip}, "times": {fmt.Sprint(times)}}, &target)
+	rtts := make([]time.Duration, len(target.Times))
+	for i, seconds := range target.Times {
+		rtts[i] = time.Duration(seconds * float64(time.Second))
+	}
+	return rtts, err
+}
+
+func (c *Client) GetIPFromSTUN(ctx context.Context, server string) (string, error) {
+	target := GetIPFromSTUNResponse{}
+	err := c.postForm(ctx, PathGetIPFromSTUN, url.Values{"stun": {server}}, &target)
+	return target.IP, err
+}
+
+// ICEOffer creates a controlling ICE agent and returns its description.
+func (c *Client) ICEOffer(ctx context.Context, opts GatherOptions) (*ICEDescription, error) {
+	target := &ICEDescription{}
+	err := c.postForm(ctx, PathICEOffer, opts.values(), target)
+	return target, err
+}
+
+// ICEAnswer creates a controlled ICE agent and returns its description.
+func (c *Client) ICEAnswer(ctx context.Context, opts GatherOptions) (*ICEDescription, error) {
+	target := &ICEDescription{}
+	err := c.postForm(ctx, PathICEAnswer, opts.values(), target)
+	return target, err
+}
+
+func (c *Client) ICESetRemote(ctx context.Context, remote *ICEDescription) error {
+	return c.postJSON(ctx, PathICERemote, remote, &struct{}{})
+}
+
+// ICEStart starts the connectivity checks without waiting for them.
+func (c *Client) ICEStart(ctx context.Context, timeout time.Duration) error {
+	return c.postForm(ctx, PathICEStart, url.Values{"timeout_seconds": {fmt.Sprint(timeout.Seconds())}}, &struct{}{})
+}
+
+func (c *Client) ICEState(ctx context.Context) (*ICEState, error) {
+	target := &ICEState{}
+	err := c.get(ctx, PathICEState, target)
+	return target, err
+}
+
+// ICECandidates waits up to wait for candidates gathered after the one with
+// the given index, starting at 0.
+func (c *Client) ICECandidates(ctx context.Context, after int, wait time.Duration) (*ICECandidatesResponse, error) {
+	target := &ICECandidatesResponse{}
+	query := url.Values{"after": {fmt.Sprint(after)}, "wait_seconds": {fmt.Sprint(wait.Seconds())}}
+	err := c.get(ctx, PathICECandidates+"?"+query.Encode(), target)
+	return target, err
+}
+
+// ICEAddRemoteCandidates trickles candidates from the remote peer, before or
+// after the connectivity checks started.
+func (c *Client) ICEAddRemoteCandidates(ctx context.Context, candidates []*Candidate) error {
+	return c.postJSON(ctx, PathICERemoteCandidates, &ICERemoteCandidates{Candidates: candidates}, &struct{}{})
+}
@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(handler http.HandlerFunc) (*Client, func()) {
+	server := httptest.NewServer(handler)
+	return &Client{BaseURL: server.URL, HTTPClient: server.Client()}, server.Close
+}
+
+func TestClientVersion(t *testing.T) {
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, PathVersion, r.URL.Path)
+		w.Write([]byte(`{"protocol":2,"implementation":"pion","capabilities":["ping","ice"]}`))
+	})
+	defer done()
+	responses := []string{}
+	client.OnResponse = func(path string, body []byte) {
+		responses = append(responses, path)
+	}
+	version, err := client.Version(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, ProtocolVersion, version.Protocol)
+	assert.True(t, version.Supports(CapabilityICE))
+	assert.False(t, version.Supports(CapabilityGetIPFromSTUN))
+	assert.Equal(t, []string{PathVersion}, responses)
+}
+
+func TestClientPing(t *testing.T) {
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "10.0.0.2", r.FormValue("ip"))
+		assert.Equal(t, "3", r.FormValue("times"))
+		w.Write([]byte(`{"times_seconds":[0.001,0.002]}`))
+	})
+	defer done()
+	times, err := client.Ping(context.Background(), "10.0.0.2", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []time.Duration{time.Millisecond, 2 * time.Millisecond}, times)
+}
+
+func TestClientGatherCandidates(t *testing.T) {
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, PathGatherCandidates, r.URL.Path)
+		assert.Equal(t, []string{"172.30.0.2"}, r.URL.Query()["ignore_address"])
+		w.Write([]byte(`{"candidates":[{"address":"172.31.0.2"}]}`))
+	})
+	defer done()
+	candidates, err := client.GatherCandidates(context.Background(), GatherOptions{IgnoreAddresses: []string{"172.30.0.2"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []*Candidate{{Address: "172.31.0.2"}}, candidates)
+}
+
+func TestClientErrors(t *testing.T) {
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case PathPing:
+			w.WriteHeader(400)
+			w.Write([]byte(`{"error":{"code":"bad-request","message":"invalid ip"}}`))
+		default:
+			w.WriteHeader(500)
+			w.Write([]byte("stun: timed out\n"))
+		}
+	})
+	defer done()
+	_, err := client.Ping(context.Background(), "nope", 3)
+	assert.EqualError(t, err, "agent /ping returned 400 bad-request: invalid ip")
+	if e, ok := err.(*Error); assert.True(t, ok) {
+		assert.Equal(t, "bad-request", e.Code)
+	}
+	_, err = client.GetIPFromSTUN(context.Background(), "10.0.0.3:3478")
+	assert.EqualError(t, err, "agent /get-ip-from-stun returned 500: stun: timed out")
+}
+
+func TestClientICEState(t *testing.T) {
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, PathICEState, r.URL.Path)
+		w.Write([]byte(`{"state":"connected","local":{"type":"srflx","protocol":"udp","address":"172.31.0.3","port":4000},"remote":{"type":"host","protocol":"udp","address":"172.31.0.4","port":5000}}`))
+	})
+	defer done()
+	state, err := client.ICEState(context.Background())
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, state.Connected())
+	assert.True(t, state.Done())
+	assert.Equal(t, "srflx udp 172.31.0.3:4000", state.Local.String())
+
+	assert.False(t, (&ICEState{State: ICEStateChecking}).Done())
+	assert.True(t, (&ICEState{State: ICEStateFailed}).Done())
+	assert.False(t, (&ICEState{State: ICEStateFailed}).Connected())
+}
+
+func TestClientICECandidates(t *testing.T) {
+	client, done := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, PathICECandidates, r.URL.Path)
+		assert.Equal(t, "2", r.FormValue("after"))
+		assert.Equal(t, "1.5", r.FormValue("wait_seconds"))
+		w.Write([]byte(`{"candidates":[{"index":3,"elapsed_seconds":0.25,"candidate":{"type":"srflx","protocol":"udp","address":"172.31.0.3","port":4000}}],"done":true}`))
+	})
+	defer done()
+	res, err := client.ICECandidates(context.Background(), 2, 1500*time.Millisecond)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, res.Done)
+	assert.Len(t, res.Candidates, 1)
+	assert.Equal(t, 0.25, res.Candidates[0].Elapsed)
+	assert.Equal(t, "srflx udp 172.31.0.3:4000", res.Candidates[0].Candidate.String())
+}
+
+func TestGatherOptionsTrickle(t *testing.T) {
+	assert.Equal(t, "stun=stun%3A10.0.0.2%3A3478&trickle=true", GatherOptions{STUN: []string{"stun:10.0.0.2:3478"}, Trickle: true}.values().Encode())
+	assert.Equal(t, "", GatherOptions{}.values().Encode())
+	assert.Equal(t, "tcp=true", GatherOptions{TCP: true}.values().Encode())
+	assert.Equal(t, "mdns=true", GatherOptions{MDNS: true}.values().Encode())
+	values := GatherOptions{TURN: []TURNServer{{URL: "turn:10.0.0.3:3478?transport=udp", Username: "u", Password: "p"}, {URL: "turn:10.0.0.4:3478", Username: "u2", Password: "p2"}}}.values()
+	assert.Equal(t, []string{"turn:10.0.0.3:3478?transport=udp", "turn:10.0.0.4:3478"}, values["turn"])
+	assert.Equal(t, []string{"u", "u2"}, values["turn_username"])
+	assert.Equal(t, []string{"p", "p2"}, values["turn_password"])
+}
+
+func TestCandidateString(t *testing.T) {
+	assert.Equal(t, "172.31.0.2", (&Candidate{Address: "172.31.0.2"}).String())
+	assert.Equal(t, "srflx udp 172.31.0.3:4000 from 10.0.0.2:5000", (&Candidate{Type: CandidateTypeSrflx, Protocol: ProtocolUDP, Address: "172.31.0.3", Port: 4000, RelatedAddress: "10.0.0.2", RelatedPort: 5000}).String())
+	assert.True(t, (&Candidate{Address: "172.31.0.2"}).IsHost())
+	assert.False(t, (&Candidate{Type: CandidateTypeRelay}).IsHost())
+	assert.Equal(t, "host tcp passive 10.0.0.2:9000", (&Candidate{Type: CandidateTypeHost, Protocol: ProtocolTCP, TCPType: TCPTypePassive, Address: "10.0.0.2", Port: 9000}).String())
+	assert.True(t, (&Candidate{Type: CandidateTypeHost, Address: "1f0e7a4c-5b3d-4c2e-9a8b-6d5e4f3a2b1c.local"}).IsMDNS())
+	assert.False(t, (&Candidate{Type: CandidateTypeHost, Address: "10.0.0.2"}).IsMDNS())
+}
@@ -0,0 +1,271 @@
+// Package agent implements the client side of the HTTP protocol spoken by
+// vortices agents, described in protocol.yaml.
+package agent
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ProtocolVersion is bumped whenever a change to the protocol is not
+// backwards compatible. Version 2 replaced /ice/local and /ice/connect with
+// /ice/offer, /ice/answer, /ice/remote, /ice/start and /ice/state, and /ping
+// times in nanoseconds with times_seconds.
+const ProtocolVersion = 2
+
+const Port = 8080
+
+const (
+	PathVersion          = "/version"
+	PathHealth           = "/health"
+	PathGatherCandidates = "/gather-candidates"
+	PathPing             = "/ping"
+	PathGetIPFromSTUN    = "/get-ip-from-stun"
+	PathICEOffer         = "/ice/offer"
+	PathICEAnswer        = "/ice/answer"
+	PathICERemote        = "/ice/remote"
+	PathICEStart         = "/ice/start"
+	PathICEState         = "/ice/state"
+
+	PathICECandidates       = "/ice/candidates"
+	PathICERemoteCandidates = "/ice/remote-candidates"
+)
+
+const (
+	CapabilityGatherCandidates = "gather-candidates"
+	CapabilityPing             = "ping"
+	CapabilityGetIPFromSTUN    = "get-ip-from-stun"
+	CapabilityICE              = "ice"
+	CapabilityTrickleICE       = "trickle-ice"
+	CapabilityICETCP           = "ice-tcp"
+	CapabilityMDNS             = "mdns"
+)
+
+type Version struct {
+	Protocol       int      `json:"protocol"`
+	Implementation string   `json:"implementation"`
+	Capabilities   []string `json:"capabilities"`
+}
+
+func (v *Version) Supports(capability string) bool {
+	for _, c := range v.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+type Health struct {
+	Status string `json:"status"`
+}
+
+// GatherOptions configure /gather-candidates, /ice/offer and /ice/answer.
+type GatherOptions struct {
+	// STUN holds STUN server URLs, e.g. stun:10.0.0.2:3478.
+	STUN []string
+	TURN []TURNServer
+	// IgnoreAddresses are addresses of interfaces that must not be used for
+	// candidates, such as the management network's.
+	IgnoreAddresses []string
+	// TCP also gathers ICE-TCP candidates, see CapabilityICETCP.
+	TCP bool
+	// MDNS hides host candidate addresses behind .local names, see
+	// CapabilityMDNS.
+	MDNS bool
+	// Trickle makes /ice/offer and /ice/answer return before gathering, with
+	// the candidates streamed from /ice/candidates instead.
+	Trickle bool
+}
+
+// TURNServer is sent as the turn, turn_username and turn_password values,
+// in the same order for every server.
+type TURNServer struct {
+	// URL is a TURN server URL, e.g. turn:10.0.0.3:3478?transport=udp.
+	URL      string
+	Username string
+	Password string
+}
+
+func (o GatherOptions) values() url.Values {
+	values := url.Values{}
+	for _, stun := range o.STUN {
+		values.Add("stun", stun)
+	}
+	for _, turn := range o.TURN {
+		values.Add("turn", turn.URL)
+		values.Add("turn_username", turn.Username)
+		values.Add("turn_password", turn.Password)
+	}
+	for _, address := range o.IgnoreAddresses {
+		values.Add("ignore_address", address)
+	}
+	if o.TCP {
+		values.Set("tcp", "true")
+	}
+	if o.MDNS {
+		values.Set("mdns", "true")
+	}
+	if o.Trickle {
+		values.Set("trickle", "true")
+	}
+	return values
+}
+
+type GatherCandidatesResponse struct {
+	Candidates []*Candidate `json:"candidates"`
+}
+
+// PingResponse holds the round trip time of every reply, in seconds.
+type PingResponse struct {
+	Times []float64 `json:"times_seconds"`
+}
+
+type GetIPFromSTUNResponse struct {
+	IP string `json:"ip"`
+}
+
+const (
+	CandidateTypeHost  = "host"
+	CandidateTypeSrflx = "srflx"
+	CandidateTypePrflx = "prflx"
+	CandidateTypeRelay = "relay"
+)
+
+const (
+	ProtocolUDP = "udp"
+	ProtocolTCP = "tcp"
+)
+
+// TCP candidate types, from RFC 6544.
+const (
+	TCPTypeActive  = "active"
+	TCPTypePassive = "passive"
+	TCPTypeSO      = "so"
+)
+
+// Candidate is an ICE candidate. Agents that report only an address are
+// treated as reporting host candidates.
+type Candidate struct {
+	Type           string `json:"type"`
+	Protocol       string `json:"protocol"`
+	Address        string `json:"address"`
+	Port           int    `json:"port"`
+	Component      int    `json:"component"`
+	Priority       uint32 `json:"priority"`
+	Foundation     string `json:"foundation,omitempty"`
+	TCPType        string `json:"tcp_type,omitempty"`
+	RelatedAddress string `json:"related_address,omitempty"`
+	RelatedPort    int    `json:"related_port,omitempty"`
+}
+
+func (c *Candidate) String() string {
+	if c.Type == "" {
+		return c.Address
+	}
+	protocol := c.Protocol
+	if c.TCPType != "" {
+		protocol += " " + c.TCPType
+	}
+	s := fmt.Sprintf("%s %s %s:%d", c.Type, protocol, c.Address, c.Port)
+	if c.RelatedAddress != "" {
+		s += fmt.Sprintf(" from %s:%d", c.RelatedAddress, c.RelatedPort)
+	}
+	return s
+}
+
+// IsHost reports whether c is a host candidate, which it is assumed to be
+// when the agent did not report its type.
+func (c *Candidate) IsHost() bool {
+	return c.Type == "" || c.Type == CandidateTypeHost
+}
+
+// IsMDNS reports whether c hides its address behind an mDNS name.
+func (c *Candidate) IsMDNS() bool {
+	return strings.HasSuffix(c.Address, ".local")
+}
+
+type ICEDescription struct {
+	Ufrag      string       `json:"ufrag"`
+	Pwd        string       `json:"pwd"`
+	Candidates []*Candidate `json:"candidates"`
+}
+
+// ICECandidateEvent is a candidate gathered by a trickling agent. Elapsed is
+// the number of seconds since the /ice/offer or /ice/answer call that started
+// gathering.
+type ICECandidateEvent struct {
+	Index     int        `json:"index"`
+	Elapsed   float64    `json:"elapsed_seconds"`
+	Candidate *Candidate `json:"candidate"`
+}
+
+type ICECandidatesResponse struct {
+	Candidates []*ICECandidateEvent `json:"candidates"`
+	// Done is set once gathering finished and every candidate was returned.
+	Done bool `json:"done"`
+}
+
+type ICERemoteCandidates struct {
+	Candidates []*Candidate `json:"candidates"`
+}
+
+const (
+	ICEStateNew          = "new"
+	ICEStateChecking     = "checking"
+	ICEStateConnected    = "connected"
+	ICEStateCompleted    = "completed"
+	ICEStateDisconnected = "disconnected"
+	ICEStateFailed       = "failed"
+	ICEStateClosed       = "closed"
+)
+
+type ICEState struct {
+	State  string     `json:"state"`
+	Local  *Candidate `json:"local"`
+	Remote *Candidate `json:"remote"`
+	Error  string     `json:"error,omitempty"`
+	// ConnectedAfter is the number of seconds from the /ice/offer or
+	// /ice/answer call to the connection, zero until connected.
+	ConnectedAfter float64 `json:"connected_after_seconds,omitempty"`
+}
+
+func (s *ICEState) Connected() bool {
+	return s.State == ICEStateConnected || s.State == ICEStateCompleted
+}
+
+// Done reports whether the connectivity checks finished, successfully or not.
+func (s *ICEState) Done() bool {
+	switch s.State {
+	case ICEStateConnected, ICEStateCompleted, ICEStateFailed, ICEStateClosed:
+		return true
+	}
+	return false
+}
+
+// ErrorResponse is the body of every non 2xx response.
+type ErrorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type Error struct {
+	Path       string
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("agent %s returned %d", e.Path, e.StatusCode)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	if message := strings.TrimSpace(e.Message); message != "" {
+		msg += ": " + message
+	}
+	return msg
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/seppo0010/vortices/agent"
+	dc "github.com/seppo0010/vortices/dockercompose"
+)
+
+func init() {
+	for _, kind := range natMatrixKinds {
+		kind := kind
+		registerTest(&Test{
+			Name:        fmt.Sprintf("gather-candidates[%s]", kind),
+			Description: fmt.Sprintf("a computer behind %s NAT gathers the host, server reflexive and relay candidates its network allows from STUN and TURN servers", kind),
+			Tags:        []string{tagNAT, tagSTUN, tagTURN},
+			Requires:    []string{capabilityGatherCandidates},
+			Weight:      natMatrixWeight(kind, natNone),
+			NAT:         kind,
+			Run: func(t *testContext) error {
+				return testGatherCandidates(t, kind)
+			},
+		})
+	}
+	registerTest(&Test{
+		Name:        "ice-candidates-srflx",
+		Description: "a computer behind a router gathers one host candidate and one server reflexive candidate on the router's internet address",
+		Tags:        []string{tagNAT, tagSTUN},
+		Requires:    []string{capabilityICE},
+		Weight:      3,
+		NAT:         string(dc.NATPortRestrictedCone),
+		Run:         testICECandidatesSrflx,
+	})
+}
+
+// candidateMatch selects the candidates whose fields equal the ones set in
+// it. A host Type also matches candidates of agents not reporting types.
+type candidateMatch struct {
+	Type           string
+	Protocol       string
+	TCPType        string
+	Address        string
+	Port           int
+	Component      int
+	Priority       uint32
+	Foundation     string
+	RelatedAddress string
+	RelatedPort    int
+}
+
+func (m candidateMatch) matches(c *agent.Candidate) bool {
+	switch {
+	case m.Type == agent.CandidateTypeHost && !c.IsHost():
+		return false
+	case m.Type != "" && m.Type != agent.CandidateTypeHost && m.Type != c.Type:
+		return false
+	case m.Protocol != "" && m.Protocol != c.Protocol:
+		return false
+	case m.TCPType != "" && m.TCPType != c.TCPType:
+		return false
+	case m.Address != "" && m.Address != c.Address:
+		return false
+	case m.Port != 0 && m.Port != c.Port:
+		return false
+	case m.Component != 0 && m.Component != c.Component:
+		return false
+	case m.Priority != 0 && m.Priority != c.Priority:
+		return false
+	case m.Foundation != "" && m.Foundation != c.Foundation:
+		return false
+	case m.RelatedAddress != "" && m.RelatedAddress != c.RelatedAddress:
+		return false
+	case m.RelatedPort != 0 && m.RelatedPort != c.RelatedPort:
+		return false
+	}
+	return true
+}
+
+func (m candidateMatch) String() string {
+	words := []string{}
+	for _, word := range []string{m.Type, m.Protocol, m.TCPType} {
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	words = append(words, "candidate")
+	if m.Address != "" {
+		words = append(words, "with address", m.Address)
+	}
+	if m.Port != 0 {
+		words = append(words, "port", fmt.Sprint(m.Port))
+	}
+	if m.Component != 0 {
+		words = append(words, "component", fmt.Sprint(m.Component))
+	}
+	if m.Priority != 0 {
+		words = append(words, "priority", fmt.Sprint(m.Priority))
+	}
+	if m.Foundation != "" {
+		words = append(words, "foundation", m.Foundation)
+	}
+	if m.RelatedAddress != "" {
+		words = append(words, "related to", m.RelatedAddress)
+	}
+	if m.RelatedPort != 0 {
+		if m.RelatedAddress == "" {
+			words = append(words, "related to")
+		}
+		words = append(words, "port", fmt.Sprint(m.RelatedPort))
+	}
+	return strings.Join(words, " ")
+}
+
+func filterCandidates(candidates []*agent.Candidate, m candidateMatch) []*agent.Candidate {
+	matched := []*agent.Candidate{}
+	for _, c := range candidates {
+		if m.matches(c) {
+			matched = append(matched, c)
+		}
+	}
+	return matched
+}
+
+// expectCandidates fails unless exactly n candidates match.
+func expectCandidates(candidates []*agent.Candidate, m candidateMatch, n int) ([]*agent.Candidate, error) {
+	matched := filterCandidates(candidates, m)
+	if len(matched) != n {
+		all := make([]string, len(candidates))
+		for i, c := range candidates {
+			all[i] = c.String()
+		}
+		return matched, fmt.Errorf("expected exactly %d %s, got %d in [%s]", n, m, len(matched), strings.Join(all, ", "))
+	}
+	return matched, nil
+}
+
+// expectCandidate fails unless exactly one candidate matches, and returns it.
+func expectCandidate(candidates []*agent.Candidate, m candidateMatch) (*agent.Candidate, error) {
+	matched, err := expectCandidates(candidates, m, 1)
+	if err != nil {
+		return nil, err
+	}
+	return matched[0], nil
+}
+
+// checkCandidatesMatch checks that there is a host candidate for each
+// address and no other.
+func checkCandidatesMatch(candidates []*agent.Candidate, ipaddresses []string) error {
+	candidates = filterCandidates(candidates, candidateMatch{Type: agent.CandidateTypeHost})
+	if len(candidates) != len(ipaddresses) {
+		return fmt.Errorf("expected %d host candidates, got %d", len(ipaddresses), len(candidates))
+	}
+	addresses := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		addresses[i] = candidate.Address
+	}
+	sort.Strings(addresses)
+	sort.Strings(ipaddresses)
+	for i, addr1 := range addresses {
+		if addr1 != ipaddresses[i] {
+			return fmt.Errorf("ip addresses do not match\ncontainer has: %#v\nreceived: %#v", ipaddresses, addresses)
+		}
+	}
+	return nil
+}
+
+func testICECandidatesSrflx(t *testContext) (err error) {
+	setup := t.NewSetup()
+	network1 := setup.NewNetwork("network1")
+	internet := setup.NewNetwork("internet")
+	router := setup.NewRouter("myrouter", t.router, []*dc.Network{network1, internet})
+	computer := t.Computer(setup.NewComputer("computer", t.image, router, []*dc.Network{network1}))
+	setup.NewSTUNServer("stun-server", []*dc.Network{internet})
+	err = t.StartSetup(setup)
+	if err != nil {
+		return err
+	}
+	defer teardown(setup, &err)
+	servers, err := iceServers(setup)
+	if err != nil {
+		return err
+	}
+	offer, err := computer.ICEOffer(servers)
+	if err != nil {
+		return err
+	}
+	t.RecordCandidates(computer.Name, offer.Candidates)
+	lanIP, err := computer.GetIPAddressForNetwork(network1)
+	if err != nil {
+		return err
+	}
+	routerIP, err := router.GetIPAddressForNetwork(internet)
+	if err != nil {
+		return err
+	}
+	_, err = expectCandidate(offer.Candidates, candidateMatch{Type: agent.CandidateTypeHost, Protocol: agent.ProtocolUDP, Address: lanIP})
+	if err != nil {
+		return err
+	}
+	_, err = expectCandidate(offer.Candidates, candidateMatch{Type: agent.CandidateTypeSrflx, Protocol: agent.ProtocolUDP, Address: routerIP, RelatedAddress: lanIP})
+	return err
+}
+
+type candidateExpectation struct {
+	match candidateMatch
+	n     int
+}
+
+// expectedGatheredCandidates are the candidates a computer with lanIP behind
+// a NAT of the given kind, with wanIP on the internet, should gather from a
+// STUN and a TURN server on the internet. Without a NAT lanIP is the
+// computer's internet address, and whether the agent keeps a server
+// reflexive candidate equal to its host candidate is not checked.
+func expectedGatheredCandidates(kind, lanIP, wanIP, turnIP string) []candidateExpectation {
+	udp := agent.ProtocolUDP
+	expected := []candidateExpectation{
+		{candidateMatch{Type: agent.CandidateTypeHost, Protocol: udp, Address: lanIP}, 1},
+	}
+	switch kind {
+	case string(dc.NATUDPBlocked):
+		return append(expected,
+			candidateExpectation{candidateMatch{Type: agent.CandidateTypeSrflx}, 0},
+			candidateExpectation{candidateMatch{Type: agent.CandidateTypeRelay}, 0},
+		)
+	case natNone:
+	default:
+		expected = append(expected, candidateExpectation{candidateMatch{Type: agent.CandidateTypeSrflx, Protocol: udp, Address: wanIP, RelatedAddress: lanIP}, 1})
+	}
+	return append(expected, candidateExpectation{candidateMatch{Type: agent.CandidateTypeRelay, Protocol: udp, Address: turnIP}, 1})
+}
+
+func testGatherCandidates(t *testContext, kind string) (err error) {
+	setup := t.NewSetup()
+	internet := setup.NewNetwork("internet")
+	setup.NewSTUNServer("stun-server", []*dc.Network{internet})
+	turn := setup.NewTURNServer("turn-server", []*dc.Network{internet})
+	computer := newNATPeer(t, setup, "computer", t.image, kind, internet)
+	err = t.StartSetup(setup)
+	if err != nil {
+		return err
+	}
+	defer teardown(setup, &err)
+	servers, err := iceServers(setup)
+	if err != nil {
+		return err
+	}
+	candidates, err := computer.GatherCandidates(servers)
+	if err != nil {
+		return err
+	}
+	lanIP, err := computer.GetIPAddress()
+	if err != nil {
+		return err
+	}
+	wanIP := lanIP
+	if computer.Gateway != nil {
+		wanIP, err = computer.Gateway.GetIPAddressForNetwork(internet)
+		if err != nil {
+			return err
+		}
+	}
+	turnIP, err := turn.GetIPAddress()
+	if err != nil {
+		return err
+	}
+	for _, expected := range expectedGatheredCandidates(kind, lanIP, wanIP, turnIP) {
+		_, err = expectCandidates(candidates, expected.match, expected.n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
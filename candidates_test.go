@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/seppo0010/vortices/agent"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpectCandidate(t *testing.T) {
+	candidates := []*agent.Candidate{
+		{Type: "host", Protocol: "udp", Address: "10.0.0.2", Port: 5000},
+		{Type: "srflx", Protocol: "udp", Address: "172.31.0.3", Port: 4000, RelatedAddress: "10.0.0.2", RelatedPort: 5000},
+		{Type: "host", Protocol: "tcp", Address: "10.0.0.2", Port: 9},
+	}
+	c, err := expectCandidate(candidates, candidateMatch{Type: "srflx", Address: "172.31.0.3", RelatedAddress: "10.0.0.2"})
+	assert.Nil(t, err)
+	assert.Equal(t, candidates[1], c)
+
+	_, err = expectCandidates(candidates, candidateMatch{Type: "host"}, 2)
+	assert.Nil(t, err)
+
+	_, err = expectCandidate(candidates, candidateMatch{Type: "srflx", Address: "172.31.0.4"})
+	assert.EqualError(t, err, "expected exactly 1 srflx candidate with address 172.31.0.4, got 0 in [host udp 10.0.0.2:5000, srflx udp 172.31.0.3:4000 from 10.0.0.2:5000, host tcp 10.0.0.2:9]")
+
+	_, err = expectCandidate(candidates, candidateMatch{Type: "host"})
+	assert.NotNil(t, err)
+}
+
+func TestExpectCandidateFields(t *testing.T) {
+	candidates := []*agent.Candidate{
+		{Type: "host", Protocol: "udp", Address: "10.0.0.2", Port: 5000, Component: 1, Priority: 2130706431, Foundation: "1"},
+		{Type: "host", Protocol: "udp", Address: "10.0.0.2", Port: 5001, Component: 2, Priority: 2130706430, Foundation: "1"},
+		{Type: "srflx", Protocol: "udp", Address: "172.31.0.3", Port: 4000, Component: 1, Priority: 1694498815, Foundation: "2", RelatedAddress: "10.0.0.2", RelatedPort: 5000},
+	}
+	c, err := expectCandidate(candidates, candidateMatch{Type: "host", Component: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, candidates[1], c)
+
+	c, err = expectCandidate(candidates, candidateMatch{Priority: 1694498815})
+	assert.Nil(t, err)
+	assert.Equal(t, candidates[2], c)
+
+	_, err = expectCandidates(candidates, candidateMatch{Foundation: "1"}, 2)
+	assert.Nil(t, err)
+
+	c, err = expectCandidate(candidates, candidateMatch{Type: "srflx", RelatedPort: 5000})
+	assert.Nil(t, err)
+	assert.Equal(t, candidates[2], c)
+
+	_, err = expectCandidate(candidates, candidateMatch{Type: "srflx", Component: 1, Foundation: "3", RelatedAddress: "10.0.0.2", RelatedPort: 5001})
+	assert.EqualError(t, err, "expected exactly 1 srflx candidate component 1 foundation 3 related to 10.0.0.2 port 5001, got 0 in [host udp 10.0.0.2:5000, host udp 10.0.0.2:5001, srflx udp 172.31.0.3:4000 from 10.0.0.2:5000]")
+}
+
+func TestCheckCandidatesMatch(t *testing.T) {
+	assert.Nil(t, checkCandidatesMatch([]*agent.Candidate{{Address: "10.0.0.2"}, {Address: "10.0.1.2"}}, []string{"10.0.1.2", "10.0.0.2"}))
+	assert.Nil(t, checkCandidatesMatch([]*agent.Candidate{
+		{Type: "host", Address: "10.0.0.2"},
+		{Type: "srflx", Address: "172.31.0.3"},
+	}, []string{"10.0.0.2"}))
+	assert.NotNil(t, checkCandidatesMatch([]*agent.Candidate{{Address: "10.0.0.3"}}, []string{"10.0.0.2"}))
+	assert.EqualError(t, checkCandidatesMatch([]*agent.Candidate{}, []string{"10.0.0.2"}), "expected 1 host candidates, got 0")
+}
+
+func TestExpectedGatheredCandidates(t *testing.T) {
+	host := &agent.Candidate{Type: "host", Protocol: "udp", Address: "10.0.0.2", Port: 5000}
+	srflx := &agent.Candidate{Type: "srflx", Protocol: "udp", Address: "172.31.0.3", Port: 4000, RelatedAddress: "10.0.0.2", RelatedPort: 5000}
+	relay := &agent.Candidate{Type: "relay", Protocol: "udp", Address: "172.31.0.4", Port: 6000, RelatedAddress: "0.0.0.0"}
+	check := func(kind string, candidates ...*agent.Candidate) error {
+		for _, expected := range expectedGatheredCandidates(kind, "10.0.0.2", "172.31.0.3", "172.31.0.4") {
+			if _, err := expectCandidates(candidates, expected.match, expected.n); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	assert.Nil(t, check("symmetric", host, srflx, relay))
+	assert.NotNil(t, check("symmetric", host, relay))
+	assert.Nil(t, check("udp-blocked", host))
+	assert.NotNil(t, check("udp-blocked", host, relay))
+	assert.Nil(t, check("none", host, relay))
+	assert.Nil(t, check("none", host, &agent.Candidate{Type: "srflx", Protocol: "udp", Address: "10.0.0.2"}, relay))
+}
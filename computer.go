@@ -1,57 +1,195 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"log"
 	"net/http"
-	"net/url"
+	"strings"
+	"time"
 
+	"github.com/seppo0010/vortices/agent"
 	dc "github.com/seppo0010/vortices/dockercompose"
 )
 
 type Computer struct {
 	*dc.Computer
+	test *testContext
 }
 
-type Candidate struct {
-	Address string `json:"address"`
+const (
+	transportDirect = "direct"
+	transportExec   = "exec"
+)
+
+// agentReadyTimeout bounds each /health request while waiting for a setup.
+const agentReadyTimeout = 2 * time.Second
+
+func newAgentClient(computer *dc.Computer, transport string) (*agent.Client, error) {
+	switch transport {
+	case transportExec:
+		client := agent.NewClient(computer.Name)
+		client.HTTPClient = &http.Client{Transport: computer.ExecTransport()}
+		return client, nil
+	case transportDirect, "":
+		ip, err := computer.GetManagementIPAddress()
+		if computer.Management == nil {
+			ip, err = computer.GetIPAddress()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return agent.NewClient(ip), nil
+	}
+	return nil, fmt.Errorf("unknown agent transport %q", transport)
+}
+
+// agentReady asks the agent of computer for /health through the test's
+// transport, so agent images do not need curl for setups to wait on them.
+func (t *testContext) agentReady(computer *dc.Computer) error {
+	client, err := newAgentClient(computer, t.transport)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(t, agentReadyTimeout)
+	defer cancel()
+	return client.Health(ctx)
+}
+
+func (c *Computer) client() (*agent.Client, error) {
+	client, err := newAgentClient(c.Computer, c.test.transport)
+	if err != nil {
+		return nil, err
+	}
+	client.OnResponse = func(path string, body []byte) {
+		_, err := c.SaveArtifact("agent", strings.Replace(strings.TrimPrefix(path, "/"), "/", "-", -1), body)
+		if err != nil {
+			log.Printf("failed to save agent response for %s: %s", c.Name, err.Error())
+		}
+	}
+	return client, nil
+}
+
+func (c *Computer) gatherOptions(opts agent.GatherOptions) (agent.GatherOptions, error) {
+	if c.Management == nil {
+		return opts, nil
+	}
+	ip, err := c.GetManagementIPAddress()
+	if err != nil {
+		return opts, err
+	}
+	opts.IgnoreAddresses = append(opts.IgnoreAddresses, ip)
+	return opts, nil
 }
 
-func (c *Computer) GatherCandidates() ([]*Candidate, error) {
-	res, err := http.Get(fmt.Sprintf("http://%s:8080/gather-candidates", c.GetIPAddress()))
+func (c *Computer) Version() (*agent.Version, error) {
+	client, err := c.client()
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
-	target := struct {
-		Candidates []*Candidate `json:"candidates"`
-	}{}
-	err = json.NewDecoder(res.Body).Decode(&target)
-	return target.Candidates, err
+	return client.Version(c.test)
 }
 
-func (c *Computer) Ping(ip string) ([]float64, error) {
-	res, err := http.PostForm(fmt.Sprintf("http://%s:8080/ping", c.GetIPAddress()), url.Values{"ip": {ip}, "times": {"3"}})
+func (c *Computer) GatherCandidates(opts agent.GatherOptions) ([]*agent.Candidate, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	opts, err = c.gatherOptions(opts)
 	if err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
-	target := struct {
-		Times []float64 `json:"times"`
-	}{}
-	err = json.NewDecoder(res.Body).Decode(&target)
-	return target.Times, err
+	candidates, err := client.GatherCandidates(c.test, opts)
+	if err == nil {
+		c.test.RecordCandidates(c.Name, candidates)
+	}
+	return candidates, err
+}
+
+func (c *Computer) Ping(ip string) ([]time.Duration, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	times, err := client.Ping(c.test, ip, 3)
+	if err == nil {
+		rtts := make([]float64, len(times))
+		for i, rtt := range times {
+			rtts[i] = float64(rtt) / float64(time.Millisecond)
+		}
+		c.test.RecordPing(c.Name, ip, rtts)
+	}
+	return times, err
 }
 
 func (c *Computer) GetIPFromSTUN(stun string) (string, error) {
-	res, err := http.PostForm(fmt.Sprintf("http://%s:8080/get-ip-from-stun", c.GetIPAddress()), url.Values{"stun": {stun}})
+	client, err := c.client()
 	if err != nil {
 		return "", err
 	}
-	defer res.Body.Close()
-	target := struct {
-		IP string `json:"ip"`
-	}{}
-	err = json.NewDecoder(res.Body).Decode(&target)
-	return target.IP, err
+	return client.GetIPFromSTUN(c.test, stun)
+}
+
+func (c *Computer) ICEOffer(opts agent.GatherOptions) (*agent.ICEDescription, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	opts, err = c.gatherOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return client.ICEOffer(c.test, opts)
+}
+
+func (c *Computer) ICEAnswer(opts agent.GatherOptions) (*agent.ICEDescription, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	opts, err = c.gatherOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return client.ICEAnswer(c.test, opts)
+}
+
+func (c *Computer) ICESetRemote(remote *agent.ICEDescription) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	return client.ICESetRemote(c.test, remote)
+}
+
+func (c *Computer) ICEStart(timeout time.Duration) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	return client.ICEStart(c.test, timeout)
+}
+
+func (c *Computer) ICEState() (*agent.ICEState, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	return client.ICEState(c.test)
+}
+
+func (c *Computer) ICECandidates(after int, wait time.Duration) (*agent.ICECandidatesResponse, error) {
+	client, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	return client.ICECandidates(c.test, after, wait)
+}
+
+func (c *Computer) ICEAddRemoteCandidates(candidates []*agent.Candidate) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	return client.ICEAddRemoteCandidates(c.test, candidates)
 }
@@ -0,0 +1,130 @@
+package dockercompose
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ArtifactCommand struct {
+	Args     []string  `json:"args"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration_seconds"`
+	ExitCode int       `json:"exit_code"`
+	Error    string    `json:"error,omitempty"`
+	Stdout   string    `json:"stdout"`
+	Stderr   string    `json:"stderr"`
+}
+
+type ArtifactFile struct {
+	Kind    string    `json:"kind"`
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Created time.Time `json:"created"`
+}
+
+type ArtifactIndex struct {
+	SetupID  string             `json:"setup_id"`
+	Created  time.Time          `json:"created"`
+	Commands []*ArtifactCommand `json:"commands"`
+	Files    []*ArtifactFile    `json:"files"`
+}
+
+type artifacts struct {
+	mu    sync.Mutex
+	dir   string
+	index ArtifactIndex
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+func artifactsRoot() string {
+	if dir := os.Getenv("VORTICES_ARTIFACTS"); dir != "" {
+		return dir
+	}
+	return path.Join(os.TempDir(), "vortices-artifacts")
+}
+
+func newArtifacts(dir, setupID string) *artifacts {
+	a := &artifacts{
+		dir: dir,
+		index: ArtifactIndex{
+			SetupID:  setupID,
+			Created:  time.Now(),
+			Commands: []*ArtifactCommand{},
+			Files:    []*ArtifactFile{},
+		},
+	}
+	data, err := ioutil.ReadFile(path.Join(dir, "index.json"))
+	if err == nil {
+		var index ArtifactIndex
+		if json.Unmarshal(data, &index) == nil && index.SetupID == setupID {
+			a.index = index
+		}
+	}
+	return a
+}
+
+func (a *artifacts) write(rel string, data []byte) error {
+	p := path.Join(a.dir, rel)
+	err := os.MkdirAll(path.Dir(p), 0744)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, data, 0644)
+}
+
+func (a *artifacts) writeIndex() error {
+	data, err := json.MarshalIndent(a.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return a.write("index.json", data)
+}
+
+func (a *artifacts) recordCommand(cmd *ArtifactCommand, stdout, stderr []byte) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	dir := path.Join("commands", fmt.Sprintf("%04d-%s", len(a.index.Commands)+1, unsafeFileChars.ReplaceAllString(path.Base(cmd.Args[0]), "_")))
+	cmd.Stdout = path.Join(dir, "stdout")
+	cmd.Stderr = path.Join(dir, "stderr")
+	a.index.Commands = append(a.index.Commands, cmd)
+	for rel, data := range map[string][]byte{
+		path.Join(dir, "argv"): []byte(strings.Join(cmd.Args, " ")),
+		cmd.Stdout:             stdout,
+		cmd.Stderr:             stderr,
+	} {
+		err := a.write(rel, data)
+		if err != nil {
+			return "", err
+		}
+	}
+	return path.Join(a.dir, dir), a.writeIndex()
+}
+
+func (a *artifacts) saveFile(kind, name string, data []byte) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	rel := path.Join(kind, fmt.Sprintf("%04d-%s", len(a.index.Files)+1, unsafeFileChars.ReplaceAllString(name, "_")))
+	err := a.write(rel, data)
+	if err != nil {
+		return "", err
+	}
+	a.index.Files = append(a.index.Files, &ArtifactFile{Kind: kind, Name: name, Path: rel, Created: time.Now()})
+	return path.Join(a.dir, rel), a.writeIndex()
+}
+
+func (a *artifacts) snapshot() ArtifactIndex {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	index := a.index
+	index.Commands = append([]*ArtifactCommand{}, a.index.Commands...)
+	index.Files = append([]*ArtifactFile{}, a.index.Files...)
+	return index
+}
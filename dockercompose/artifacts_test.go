@@ -0,0 +1,49 @@
+package dockercompose
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecRecordsArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vortices-artifacts")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	setup := NewSetup()
+	setup.ArtifactDir = dir
+	setup.exec(runRequest{args: []string{"sh", "-c", "echo out; echo err >&2; exit 3"}})
+	_, err = setup.SaveArtifact("agent", "response", []byte(`{"ok":true}`))
+	assert.Nil(t, err)
+
+	data, err := ioutil.ReadFile(path.Join(dir, "index.json"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	var index ArtifactIndex
+	if !assert.Nil(t, json.Unmarshal(data, &index)) {
+		return
+	}
+	assert.Equal(t, index.SetupID, setup.ID)
+	if !assert.Equal(t, len(index.Commands), 1) {
+		return
+	}
+	assert.Equal(t, index.Commands[0].ExitCode, 3)
+	stdout, _ := ioutil.ReadFile(path.Join(dir, index.Commands[0].Stdout))
+	assert.Equal(t, string(stdout), "out\n")
+	stderr, _ := ioutil.ReadFile(path.Join(dir, index.Commands[0].Stderr))
+	assert.Equal(t, string(stderr), "err\n")
+	if !assert.Equal(t, len(index.Files), 1) {
+		return
+	}
+	assert.Equal(t, index.Files[0].Kind, "agent")
+	response, _ := ioutil.ReadFile(path.Join(dir, index.Files[0].Path))
+	assert.Equal(t, string(response), `{"ok":true}`)
+}
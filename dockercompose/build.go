@@ -3,43 +3,158 @@ package dockercompose
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/google/uuid"
 )
 
+type BuildOptions struct {
+	BuildArgs map[string]string
+	// Contexts are named build contexts, usable from the Dockerfile with
+	// COPY --from=<name>. They need BuildKit.
+	Contexts map[string]string
+	Target   string
+	Force    bool
+}
+
+var invalidTagChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+func imageTag(name string) string {
+	tag := strings.Trim(invalidTagChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if tag == "" {
+		tag = "image"
+	}
+	return "vortices/" + tag
+}
+
+type logWriter struct {
+	prefix string
+	mu     sync.Mutex
+	buf    []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		log.Printf("%s%s", w.prefix, strings.TrimRight(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *logWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		log.Printf("%s%s", w.prefix, string(w.buf))
+		w.buf = nil
+	}
+}
+
+func buildArgs(name, path, iidFile, hash string, opts BuildOptions) []string {
+	args := []string{"build", "--iidfile", iidFile, "-t", imageTag(name), "--label", fmt.Sprintf("%s=%s", contentHashLabel, hash)}
+	keys := make([]string, 0, len(opts.BuildArgs))
+	for key := range opts.BuildArgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "--build-arg", fmt.Sprintf("%s=%s", key, opts.BuildArgs[key]))
+	}
+	names := make([]string, 0, len(opts.Contexts))
+	for name := range opts.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "--build-context", fmt.Sprintf("%s=%s", name, opts.Contexts[name]))
+	}
+	if opts.Target != "" {
+		args = append(args, "--target", opts.Target)
+	}
+	return append(args, path)
+}
+
 func BuildDockerPath(name, path string) (string, error) {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return "", fmt.Errorf("path %s does not exist", path)
+	return BuildDockerPathWithOptions(name, path, BuildOptions{})
+}
+
+func BuildDockerPathWithOptions(name, dirPath string, opts BuildOptions) (string, error) {
+	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
+		return "", fmt.Errorf("path %s does not exist", dirPath)
 	}
 
+	hash, err := contentHash(dirPath, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash docker context at path %s: %s", dirPath, err.Error())
+	}
+	return dedupBuild(hash, func() (string, error) {
+		if !opts.Force {
+			id, err := findImageByContentHash(hash)
+			if err != nil {
+				return "", err
+			}
+			if id != "" {
+				log.Printf("reusing docker image %s for %s", id, name)
+				return id, nil
+			}
+		}
+		return build(name, dirPath, hash, opts)
+	})
+}
+
+func build(name, dirPath, hash string, opts BuildOptions) (string, error) {
+	iidFile := path.Join(os.TempDir(), uuid.New().String()+".iid")
+	defer os.Remove(iidFile)
+
 	log.Printf("starting to build docker image %s", name)
 	defer log.Printf("finished building docker image %s", name)
-	var out bytes.Buffer
-	cmd := exec.Command("docker", "build", path)
-	cmd.Stdout = &out
+	output := &logWriter{prefix: fmt.Sprintf("[build %s] ", name)}
+	defer output.Flush()
+	cmd := exec.Command("docker", buildArgs(name, dirPath, iidFile, hash, opts)...)
+	cmd.Stdout = output
+	cmd.Stderr = output
 	err := cmd.Run()
 	if err != nil {
-		return "", fmt.Errorf("failed to build docker image at path %s: %s", path, err.Error())
-	}
-	submatches := regexp.MustCompile(`Successfully built ([a-fA-F0-9]*)`).FindStringSubmatch(string(out.Bytes()))
-	if len(submatches) == 0 {
-		return "", fmt.Errorf("could not find docker image tag. Full output:\n%s", string(out.Bytes()))
+		return "", fmt.Errorf("failed to build docker image at path %s: %s", dirPath, err.Error())
 	}
 
-	return submatches[1], nil
+	iid, err := ioutil.ReadFile(iidFile)
+	if err != nil {
+		return "", fmt.Errorf("could not read docker image id: %s", err.Error())
+	}
+	id := strings.TrimPrefix(strings.TrimSpace(string(iid)), "sha256:")
+	if id == "" {
+		return "", fmt.Errorf("docker build did not report an image id for %s", dirPath)
+	}
+	return id, nil
 }
 
 func BuildDocker(name, script string) (string, error) {
+	return BuildDockerWithOptions(name, script, BuildOptions{})
+}
+
+func BuildDockerWithOptions(name, script string, opts BuildOptions) (string, error) {
 	dirPath := path.Join(os.TempDir(), uuid.New().String())
 	err := os.MkdirAll(dirPath, 0744)
 	if err != nil {
 		return "", err
 	}
+	defer os.RemoveAll(dirPath)
 
 	filePath := path.Join(dirPath, "Dockerfile")
 	f, err := os.Create(filePath)
@@ -52,5 +167,5 @@ func BuildDocker(name, script string) (string, error) {
 	}
 	f.Close()
 
-	return BuildDockerPath(name, dirPath)
+	return BuildDockerPathWithOptions(name, dirPath, opts)
 }
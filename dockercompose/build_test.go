@@ -0,0 +1,30 @@
+package dockercompose
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageTag(t *testing.T) {
+	assert.Equal(t, imageTag("noop ubuntu"), "vortices/noop-ubuntu")
+	assert.Equal(t, imageTag("./examples/pion"), "vortices/examples-pion")
+	assert.Equal(t, imageTag("Router"), "vortices/router")
+	assert.Equal(t, imageTag("///"), "vortices/image")
+}
+
+func TestBuildArgs(t *testing.T) {
+	args := buildArgs("router", "/tmp/router", "/tmp/router.iid", "abc", BuildOptions{
+		BuildArgs: map[string]string{"B": "2", "A": "1"},
+		Contexts:  map[string]string{"vortices-agent": "/src/vortices/agent"},
+		Target:    "final",
+	})
+	assert.Equal(t, args, []string{
+		"build", "--iidfile", "/tmp/router.iid", "-t", "vortices/router",
+		"--label", "vortices.content-hash=abc",
+		"--build-arg", "A=1", "--build-arg", "B=2",
+		"--build-context", "vortices-agent=/src/vortices/agent",
+		"--target", "final",
+		"/tmp/router",
+	})
+}
@@ -0,0 +1,126 @@
+package dockercompose
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const contentHashLabel = "vortices.content-hash"
+
+func contentHash(dirPath string, opts BuildOptions) (string, error) {
+	h := sha256.New()
+	err := hashDir(h, dirPath)
+	if err != nil {
+		return "", err
+	}
+
+	keys := make([]string, 0, len(opts.BuildArgs))
+	for key := range opts.BuildArgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(h, "arg\x00%s\x00%s\x00", key, opts.BuildArgs[key])
+	}
+	names := make([]string, 0, len(opts.Contexts))
+	for name := range opts.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "context\x00%s\x00", name)
+		err = hashDir(h, opts.Contexts[name])
+		if err != nil {
+			return "", err
+		}
+	}
+	fmt.Fprintf(h, "target\x00%s\x00", opts.Target)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashDir(h io.Writer, dirPath string) error {
+	return filepath.Walk(dirPath, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dirPath, p)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%o\x00", filepath.ToSlash(rel), info.Mode())
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s\x00", target)
+		case info.Mode().IsRegular():
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			fmt.Fprintf(h, "%d\x00", info.Size())
+			if _, err := io.Copy(h, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func findImageByContentHash(hash string) (string, error) {
+	out, err := exec.Command("docker", "images", "-q", "--no-trunc", "--filter", fmt.Sprintf("label=%s=%s", contentHashLabel, hash)).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to list docker images: %s", err.Error())
+	}
+	lines := strings.Fields(string(out))
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.TrimPrefix(lines[0], "sha256:"), nil
+}
+
+type buildCall struct {
+	done    chan struct{}
+	waiters int
+	id      string
+	err     error
+}
+
+var (
+	buildsMu sync.Mutex
+	builds   = map[string]*buildCall{}
+)
+
+// dedupBuild runs build once per hash at a time; concurrent callers asking
+// for the same hash wait for the running build and share its result.
+func dedupBuild(hash string, build func() (string, error)) (string, error) {
+	buildsMu.Lock()
+	if call, found := builds[hash]; found {
+		call.waiters++
+		buildsMu.Unlock()
+		<-call.done
+		return call.id, call.err
+	}
+	call := &buildCall{done: make(chan struct{})}
+	builds[hash] = call
+	buildsMu.Unlock()
+
+	call.id, call.err = build()
+	close(call.done)
+
+	buildsMu.Lock()
+	delete(builds, hash)
+	buildsMu.Unlock()
+	return call.id, call.err
+}
@@ -0,0 +1,91 @@
+package dockercompose
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeContext(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "vortices-context")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		err = os.MkdirAll(path.Dir(path.Join(dir, name)), 0744)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path.Join(dir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestContentHash(t *testing.T) {
+	dir1 := writeContext(t, map[string]string{"Dockerfile": "FROM ubuntu\n", "app/main.go": "package main\n"})
+	defer os.RemoveAll(dir1)
+	dir2 := writeContext(t, map[string]string{"Dockerfile": "FROM ubuntu\n", "app/main.go": "package main\n"})
+	defer os.RemoveAll(dir2)
+	dir3 := writeContext(t, map[string]string{"Dockerfile": "FROM debian\n", "app/main.go": "package main\n"})
+	defer os.RemoveAll(dir3)
+
+	hash1, err := contentHash(dir1, BuildOptions{})
+	assert.Nil(t, err)
+	hash2, err := contentHash(dir2, BuildOptions{})
+	assert.Nil(t, err)
+	hash3, err := contentHash(dir3, BuildOptions{})
+	assert.Nil(t, err)
+	hashArgs, err := contentHash(dir1, BuildOptions{BuildArgs: map[string]string{"A": "1"}})
+	assert.Nil(t, err)
+	hashTarget, err := contentHash(dir1, BuildOptions{Target: "final"})
+	assert.Nil(t, err)
+	hashContext, err := contentHash(dir1, BuildOptions{Contexts: map[string]string{"other": dir3}})
+	assert.Nil(t, err)
+
+	assert.Equal(t, hash1, hash2, "same context in different directories")
+	assert.NotEqual(t, hash1, hash3, "different Dockerfile")
+	assert.NotEqual(t, hash1, hashArgs, "different build args")
+	assert.NotEqual(t, hash1, hashTarget, "different target")
+	assert.NotEqual(t, hash1, hashContext, "named build context")
+}
+
+func TestDedupBuild(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	ids := make([]string, 5)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], _ = dedupBuild("hash", func() (string, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "image", nil
+			})
+		}(i)
+	}
+	for {
+		runtime.Gosched()
+		buildsMu.Lock()
+		call, started := builds["hash"]
+		waiting := started && call.waiters == len(ids)-1
+		buildsMu.Unlock()
+		if waiting {
+			break
+		}
+	}
+	close(release)
+	wg.Wait()
+	assert.Equal(t, []string{"image", "image", "image", "image", "image"}, ids)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
@@ -3,7 +3,6 @@ package dockercompose
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"strings"
 )
 
@@ -12,23 +11,45 @@ type BaseComputer struct {
 	Name     string
 	Image    string
 	Networks []*Network
+	Labels   map[string]string
+	// Environment is passed to the container as environment variables.
+	Environment map[string]string
+	// Command overrides the arguments of the image's command.
+	Command []string
+	// HealthCheck, when set, is added to the compose file and used by
+	// Setup.StartWithOptions to wait until the container is ready.
+	HealthCheck *HealthCheck
+	// Management is an extra network hidden from GetAllIPAddresses.
+	Management *Network
 }
 
 func (comp *BaseComputer) ToYML() string {
 	networks := ""
 	ports := ""
-	if len(comp.Networks) > 0 {
+	all := comp.Networks
+	if comp.Management != nil {
+		all = append(append([]*Network{}, all...), comp.Management)
+	}
+	if len(all) > 0 {
 		networks = "    networks:\n"
-		for _, network := range comp.Networks {
+		for _, network := range all {
 			networks += fmt.Sprintf("      %s:\n", network.Name)
 		}
 	}
+	command := ""
+	if len(comp.Command) > 0 {
+		args := make([]string, len(comp.Command))
+		for i, arg := range comp.Command {
+			args[i] = fmt.Sprintf("%q", arg)
+		}
+		command = fmt.Sprintf("    command: [%s]\n", strings.Join(args, ", "))
+	}
 	return fmt.Sprintf(`  %s:
     container_name: %s
     image: %s
+%s%s%s%s%s
 %s
-%s
-`, comp.Name, comp.Name, comp.Image, networks, ports)
+`, comp.Name, comp.Name, comp.Image, command, labelsToYML(comp.Labels, "    "), mapToYML("environment", comp.Environment, "    "), comp.HealthCheck.ToYML("    "), networks, ports)
 }
 
 func newBaseComputer(setup *Setup, name, image string, networks []*Network) *BaseComputer {
@@ -37,6 +58,7 @@ func newBaseComputer(setup *Setup, name, image string, networks []*Network) *Bas
 		Name:     setup.makeName(name),
 		Image:    image,
 		Networks: networks,
+		Labels:   setup.labels(),
 	}
 }
 
@@ -52,12 +74,15 @@ type Computer struct {
 	Gateway *Router
 }
 
-func (comp *BaseComputer) GetIPAddress() string {
+func (comp *BaseComputer) GetIPAddress() (string, error) {
 	ips, err := comp.GetAllIPAddresses()
 	if err != nil {
-		log.Fatalf("failed to get ip addresses: %s", err.Error())
+		return "", err
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("%s has no ip address", comp.Name)
 	}
-	return ips[0]
+	return ips[0], nil
 }
 
 func (comp *BaseComputer) GetIPAddressForNetwork(network *Network) (string, error) {
@@ -78,7 +103,7 @@ func (comp *BaseComputer) GetIPAddressForNetwork(network *Network) (string, erro
 			args: []string{"docker", "inspect", "-f", "{{range $key, $value := .Labels}}{{if eq $key \"com.docker.compose.network\"}}{{$value}}{{end}}{{end}}", network_id},
 		})
 		if networkLabelExec.err != nil {
-			return "", err
+			return "", networkLabelExec.err
 		}
 
 		if strings.Trim(string(networkLabelExec.stdout), " \n") == network.Name {
@@ -93,17 +118,54 @@ func (comp *BaseComputer) GetIPAddressForNetwork(network *Network) (string, erro
 			return ipStr, nil
 		}
 	}
-	return "", fmt.Errorf("could not find ip address for %s in network %s", comp.Name, network.Name)
+	return "", &NetworkNotFoundError{Computer: comp.Name, Network: network.Name}
+}
+
+func (comp *BaseComputer) GetManagementIPAddress() (string, error) {
+	if comp.Management == nil {
+		return "", fmt.Errorf("%s is not in a management network", comp.Name)
+	}
+	return comp.GetIPAddressForNetwork(comp.Management)
 }
 
 func (comp *BaseComputer) GetAllIPAddresses() ([]string, error) {
 	networksExec := comp.setup.exec(runRequest{
-		args: []string{"docker", "inspect", "-f", "{{range .NetworkSettings.Networks}}{{.IPAddress}} {{end}}", comp.Name},
+		args: []string{"docker", "inspect", "-f", "{{range $name, $network := .NetworkSettings.Networks}}{{$name}} {{$network.IPAddress}}\n{{end}}", comp.Name},
 	})
 	if networksExec.err != nil {
 		return nil, networksExec.err
 	}
-	return strings.Split(strings.Trim(string(networksExec.stdout), " \n"), " "), nil
+	return comp.parseIPAddresses(networksExec.stdout), nil
+}
+
+// parseIPAddresses skips the management network, which docker names after
+// the compose project followed by the network name.
+func (comp *BaseComputer) parseIPAddresses(out []byte) []string {
+	ips := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if comp.Management != nil && (fields[0] == comp.Management.Name || strings.HasSuffix(fields[0], "_"+comp.Management.Name)) {
+			continue
+		}
+		ips = append(ips, fields[1])
+	}
+	return ips
+}
+
+func (comp *BaseComputer) setEnvironment(env map[string]string) {
+	if comp.Environment == nil {
+		comp.Environment = map[string]string{}
+	}
+	for key, value := range env {
+		comp.Environment[key] = value
+	}
+}
+
+func (comp *BaseComputer) SaveArtifact(kind, name string, data []byte) (string, error) {
+	return comp.setup.SaveArtifact(kind, fmt.Sprintf("%s-%s", comp.Name, name), data)
 }
 
 func findSharedNetwork(networks1, networks2 []*Network) *Network {
@@ -126,6 +188,12 @@ func (comp *BaseComputer) GetIPAddressFor(comp2 *BaseComputer) (string, error) {
 }
 
 func (comp *Computer) Start() error {
+	for _, server := range comp.setup.SignalingServers {
+		err := comp.addHost(server.BaseComputer)
+		if err != nil {
+			return err
+		}
+	}
 	if comp.Gateway != nil {
 		ipAddress, err := comp.GetIPAddressFor(comp.Gateway.BaseComputer)
 		if err != nil {
@@ -135,7 +203,7 @@ func (comp *Computer) Start() error {
 			args: []string{"docker", "exec", "--privileged", comp.Name, "ip", "route", "del", "default"},
 		})
 		if ipRouteDelDefault.err != nil {
-			return err
+			return ipRouteDelDefault.err
 		}
 
 		ipRouteAddDefault := comp.setup.exec(runRequest{
@@ -145,5 +213,85 @@ func (comp *Computer) Start() error {
 			return ipRouteAddDefault.err
 		}
 	}
+	err := comp.routeMulticast()
+	if err != nil {
+		return err
+	}
+	return comp.dropManagementMulticast()
+}
+
+// routeMulticast sends multicast through the first multicast network, as it
+// would otherwise leave through the default route.
+func (comp *Computer) routeMulticast() error {
+	for _, network := range comp.Networks {
+		if !network.Multicast {
+			continue
+		}
+		ip, err := comp.GetIPAddressForNetwork(network)
+		if err != nil {
+			return err
+		}
+		addresses := comp.setup.exec(runRequest{args: []string{"docker", "exec", comp.Name, "ip", "-o", "-4", "addr", "show"}})
+		if addresses.err != nil {
+			return addresses.err
+		}
+		iface, found := parseInterfaceAddresses(addresses.stdout)[ip]
+		if !found {
+			return fmt.Errorf("no interface in %s has address %s", comp.Name, ip)
+		}
+		return comp.setup.exec(runRequest{args: multicastRouteArgs(comp.Name, iface)}).err
+	}
 	return nil
 }
+
+func multicastRouteArgs(container, iface string) []string {
+	return []string{"docker", "exec", "--privileged", container, "ip", "route", "replace", "224.0.0.0/4", "dev", iface}
+}
+
+// dropManagementMulticast keeps multicast off the management network, which
+// every computer of the setup shares: agents such as pion send mDNS on every
+// interface regardless of routes, and would otherwise reach each other there.
+func (comp *Computer) dropManagementMulticast() error {
+	if comp.Management == nil || comp.setup.ToolsImage == "" || !comp.setup.multicast() {
+		return nil
+	}
+	ip, err := comp.GetManagementIPAddress()
+	if err != nil {
+		return err
+	}
+	addresses := comp.setup.exec(runRequest{args: toolsArgs(comp.Name, comp.setup.ToolsImage, "ip", "-o", "-4", "addr", "show")})
+	if addresses.err != nil {
+		return addresses.err
+	}
+	iface, found := parseInterfaceAddresses(addresses.stdout)[ip]
+	if !found {
+		return fmt.Errorf("no interface in %s has address %s", comp.Name, ip)
+	}
+	return comp.setup.exec(runRequest{args: toolsArgs(comp.Name, comp.setup.ToolsImage, "sh", "-c", dropMulticastScript(iface))}).err
+}
+
+// toolsArgs runs command from image in the network namespace of container.
+func toolsArgs(container, image string, command ...string) []string {
+	return append([]string{"docker", "run", "--rm", "--privileged", "--network", "container:" + container, image}, command...)
+}
+
+func dropMulticastScript(iface string) string {
+	return fmt.Sprintf("iptables -A OUTPUT -o %s -d 224.0.0.0/4 -j DROP && iptables -A INPUT -i %s -d 224.0.0.0/4 -j DROP", iface, iface)
+}
+
+// addHost makes comp2 resolvable by name from comp even when they share no
+// network and docker's DNS cannot answer for it, e.g. from behind a router.
+func (comp *Computer) addHost(comp2 *BaseComputer) error {
+	if findSharedNetwork(comp.Networks, comp2.Networks) != nil {
+		return nil
+	}
+	ip, err := comp2.GetIPAddress()
+	if err != nil {
+		return err
+	}
+	addHost := comp.setup.exec(runRequest{
+		args:  []string{"docker", "exec", "-i", "--privileged", comp.Name, "sh", "-c", "cat >> /etc/hosts"},
+		stdin: []byte(fmt.Sprintf("%s %s\n", ip, comp2.Name)),
+	})
+	return addHost.err
+}
@@ -3,6 +3,7 @@ package dockercompose
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -16,12 +17,15 @@ func TestComputerYMLTwoNetworks(t *testing.T) {
 	assert.Equal(t, yml, fmt.Sprintf(`  %s_computer:
     container_name: %s_computer
     image: ubuntu
+    labels:
+      vortices.created: "%s"
+      vortices.setup: "%s"
     networks:
       network1:
       network2:
 
 
-`, setup.ID, setup.ID))
+`, setup.ID, setup.ID, setup.Created.Format(time.RFC3339), setup.ID))
 }
 
 func TestGetAllIPAddresses(t *testing.T) {
@@ -55,3 +59,12 @@ CMD ["sleep", "infinity"]
 		}
 	}
 }
+
+func TestMulticastRouteArgs(t *testing.T) {
+	assert.Equal(t, []string{"docker", "exec", "--privileged", "setup_computer", "ip", "route", "replace", "224.0.0.0/4", "dev", "eth1"}, multicastRouteArgs("setup_computer", "eth1"))
+}
+
+func TestDropManagementMulticastArgs(t *testing.T) {
+	assert.Equal(t, []string{"docker", "run", "--rm", "--privileged", "--network", "container:setup_computer", "router", "ip", "-o", "-4", "addr", "show"}, toolsArgs("setup_computer", "router", "ip", "-o", "-4", "addr", "show"))
+	assert.Equal(t, "iptables -A OUTPUT -o eth2 -d 224.0.0.0/4 -j DROP && iptables -A INPUT -i eth2 -d 224.0.0.0/4 -j DROP", dropMulticastScript("eth2"))
+}
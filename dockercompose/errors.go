@@ -0,0 +1,66 @@
+package dockercompose
+
+import (
+	"fmt"
+	"strings"
+)
+
+type ExecError struct {
+	Args     []string
+	Stderr   string
+	ExitCode int
+	Err      error
+}
+
+func (e *ExecError) Error() string {
+	msg := fmt.Sprintf("command %q failed", strings.Join(e.Args, " "))
+	if e.ExitCode >= 0 {
+		msg += fmt.Sprintf(" with exit code %d", e.ExitCode)
+	} else {
+		msg += fmt.Sprintf(": %s", e.Err.Error())
+	}
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += fmt.Sprintf(": %s", stderr)
+	}
+	return msg
+}
+
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+type ComposeError struct {
+	SetupID string
+	Action  string
+	Err     error
+}
+
+func (e *ComposeError) Error() string {
+	return fmt.Sprintf("docker-compose %s failed for setup %s: %s", e.Action, e.SetupID, e.Err.Error())
+}
+
+func (e *ComposeError) Unwrap() error {
+	return e.Err
+}
+
+type NetworkNotFoundError struct {
+	Computer string
+	Network  string
+}
+
+func (e *NetworkNotFoundError) Error() string {
+	return fmt.Sprintf("could not find ip address for %s in network %s", e.Computer, e.Network)
+}
+
+type NotReadyError struct {
+	Container string
+	Err       error
+}
+
+func (e *NotReadyError) Error() string {
+	return fmt.Sprintf("%s is not ready: %s", e.Container, e.Err.Error())
+}
+
+func (e *NotReadyError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,45 @@
+package dockercompose
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vortices-artifacts")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	setup := NewSetup()
+	setup.ArtifactDir = dir
+
+	rr := setup.exec(runRequest{args: []string{"sh", "-c", "echo broken >&2; exit 2"}})
+	err = &ComposeError{SetupID: setup.ID, Action: "up", Err: rr.err}
+	var execErr *ExecError
+	if !assert.True(t, errors.As(err, &execErr)) {
+		return
+	}
+	assert.Equal(t, execErr.Args, []string{"sh", "-c", "echo broken >&2; exit 2"})
+	assert.Equal(t, execErr.ExitCode, 2)
+	assert.Equal(t, execErr.Stderr, "broken\n")
+	assert.Equal(t, err.Error(), fmt.Sprintf(`docker-compose up failed for setup %s: command "sh -c echo broken >&2; exit 2" failed with exit code 2: broken`, setup.ID))
+
+	rr = setup.exec(runRequest{args: []string{"/nonexistent/vortices"}})
+	if !assert.True(t, errors.As(rr.err, &execErr)) {
+		return
+	}
+	assert.Equal(t, execErr.ExitCode, -1)
+}
+
+func TestNetworkNotFoundError(t *testing.T) {
+	var err error = &NetworkNotFoundError{Computer: "computer", Network: "network"}
+	var notFound *NetworkNotFoundError
+	assert.True(t, errors.As(fmt.Errorf("wrapped: %w", err), &notFound))
+	assert.Equal(t, err.Error(), "could not find ip address for computer in network network")
+}
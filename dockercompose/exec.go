@@ -2,17 +2,16 @@ package dockercompose
 
 import (
 	"bytes"
+	"context"
 	"log"
-	"os"
 	"os/exec"
-	"path"
-	"strings"
-
-	"github.com/google/uuid"
+	"time"
 )
 
 type runRequest struct {
-	args []string
+	args  []string
+	stdin []byte
+	ctx   context.Context
 }
 
 type runResponse struct {
@@ -21,50 +20,58 @@ type runResponse struct {
 	err    error
 }
 
-func (s *Setup) exec(r runRequest) runResponse {
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+func run(dir string, r runRequest) runResponse {
 	var rr runResponse
 	var stdout, stderr bytes.Buffer
-	cmd := exec.Command(r.args[0], r.args[1:]...)
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cmd := exec.CommandContext(ctx, r.args[0], r.args[1:]...)
+	if r.stdin != nil {
+		cmd.Stdin = bytes.NewReader(r.stdin)
+	}
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
-	cmd.Dir = s.tmpDir
-	rr.err = cmd.Run()
+	cmd.Dir = dir
+	err := cmd.Run()
 	rr.stdout = stdout.Bytes()
 	rr.stderr = stderr.Bytes()
-	if rr.err != nil {
-		log.Printf("command failed, creating logs in %s", s.tmpDir)
-		dir := path.Join(s.tmpDir, uuid.New().String())
-		err := os.MkdirAll(dir, 0744)
-		if err != nil {
-			log.Printf("error creating directory (%s): %s", dir, err.Error())
-		}
-
-		f, err := os.Create(path.Join(dir, "argv"))
-		if err != nil {
-			log.Printf("error creating argv file (%s): %s", dir, err.Error())
-		}
-		_, err = f.WriteString(strings.Join(r.args, " "))
-		if err != nil {
-			log.Printf("error writing argv (%s): %s", dir, err.Error())
-		}
+	if err != nil {
+		rr.err = &ExecError{Args: r.args, Stderr: string(rr.stderr), ExitCode: exitCode(err), Err: err}
+	}
+	return rr
+}
 
-		f, err = os.Create(path.Join(dir, "stdout"))
-		if err != nil {
-			log.Printf("error creating stdout file (%s): %s", dir, err.Error())
-		}
-		_, err = f.Write(rr.stdout)
-		if err != nil {
-			log.Printf("error writing stdout (%s): %s", dir, err.Error())
-		}
+func (s *Setup) exec(r runRequest) runResponse {
+	start := time.Now()
+	rr := run(s.tmpDir, r)
 
-		f, err = os.Create(path.Join(dir, "stderr"))
-		if err != nil {
-			log.Printf("error creating stderr file (%s): %s", dir, err.Error())
-		}
-		_, err = f.Write(rr.stderr)
-		if err != nil {
-			log.Printf("error writing stderr (%s): %s", dir, err.Error())
-		}
+	record := &ArtifactCommand{
+		Args:     r.args,
+		Start:    start,
+		Duration: time.Since(start).Seconds(),
+	}
+	if rr.err != nil {
+		record.ExitCode = rr.err.(*ExecError).ExitCode
+		record.Error = rr.err.Error()
+	}
+	dir, err := s.getArtifacts().recordCommand(record, rr.stdout, rr.stderr)
+	if err != nil {
+		log.Printf("error recording command in %s: %s", s.ArtifactDir, err.Error())
+	}
+	if rr.err != nil {
+		log.Printf("command failed with exit code %d, logs in %s", record.ExitCode, dir)
 	}
 	return rr
 }
@@ -0,0 +1,118 @@
+package dockercompose
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	setupLabel   = "vortices.setup"
+	createdLabel = "vortices.created"
+)
+
+func parseSetupListing(out []byte, setups map[string]time.Time) {
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) != 2 || fields[0] == "" {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			created = time.Time{}
+		}
+		if old, found := setups[fields[0]]; !found || created.Before(old) {
+			setups[fields[0]] = created
+		}
+	}
+}
+
+func listSetups() (map[string]time.Time, error) {
+	format := fmt.Sprintf("{{.Label %q}}\t{{.Label %q}}", setupLabel, createdLabel)
+	setups := map[string]time.Time{}
+	for _, args := range [][]string{
+		{"docker", "ps", "-a", "--filter", "label=" + setupLabel, "--format", format},
+		{"docker", "network", "ls", "--filter", "label=" + setupLabel, "--format", format},
+	} {
+		rr := run("", runRequest{args: args})
+		if rr.err != nil {
+			return nil, rr.err
+		}
+		parseSetupListing(rr.stdout, setups)
+	}
+	return setups, nil
+}
+
+func removeLabelled(id string) error {
+	filter := fmt.Sprintf("label=%s=%s", setupLabel, id)
+	containers := run("", runRequest{args: []string{"docker", "ps", "-aq", "--filter", filter}})
+	if containers.err != nil {
+		return containers.err
+	}
+	if ids := strings.Fields(string(containers.stdout)); len(ids) > 0 {
+		rr := run("", runRequest{args: append([]string{"docker", "rm", "-f"}, ids...)})
+		if rr.err != nil {
+			return rr.err
+		}
+	}
+	networks := run("", runRequest{args: []string{"docker", "network", "ls", "-q", "--filter", filter}})
+	if networks.err != nil {
+		return networks.err
+	}
+	if ids := strings.Fields(string(networks.stdout)); len(ids) > 0 {
+		rr := run("", runRequest{args: append([]string{"docker", "network", "rm"}, ids...)})
+		if rr.err != nil {
+			return rr.err
+		}
+	}
+	return nil
+}
+
+func RemoveStaleSetups(ttl time.Duration) ([]string, error) {
+	setups, err := listSetups()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	removed := []string{}
+	for id, created := range setups {
+		if now.Sub(created) < ttl {
+			continue
+		}
+		log.Printf("removing setup %s created at %s", id, created.Format(time.RFC3339))
+		if _, err := os.Stat(path.Join(setupDir(id), "docker-compose.yml")); err == nil {
+			err = Down(id)
+			if err != nil {
+				log.Printf("docker-compose down failed for setup %s: %s", id, err.Error())
+			}
+		}
+		err = removeLabelled(id)
+		if err != nil {
+			return removed, fmt.Errorf("failed to remove setup %s: %w", id, err)
+		}
+		os.RemoveAll(setupDir(id))
+		removed = append(removed, id)
+	}
+
+	dirs, err := ioutil.ReadDir(path.Join(os.TempDir(), "vortices"))
+	if err != nil && !os.IsNotExist(err) {
+		return removed, err
+	}
+	for _, dir := range dirs {
+		if _, live := setups[dir.Name()]; live || !dir.IsDir() || now.Sub(dir.ModTime()) < ttl {
+			continue
+		}
+		log.Printf("removing orphaned directory %s", setupDir(dir.Name()))
+		err = os.RemoveAll(setupDir(dir.Name()))
+		if err != nil {
+			return removed, err
+		}
+	}
+	sort.Strings(removed)
+	return removed, nil
+}
@@ -0,0 +1,18 @@
+package dockercompose
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSetupListing(t *testing.T) {
+	setups := map[string]time.Time{}
+	parseSetupListing([]byte("a\t2019-08-01T10:00:00Z\nb\t2019-08-01T11:00:00Z\na\t2019-08-01T09:00:00Z\n\n\t\nc\tnot a date\n"), setups)
+	assert.Equal(t, map[string]time.Time{
+		"a": time.Date(2019, 8, 1, 9, 0, 0, 0, time.UTC),
+		"b": time.Date(2019, 8, 1, 11, 0, 0, 0, time.UTC),
+		"c": time.Time{},
+	}, setups)
+}
@@ -0,0 +1,157 @@
+package dockercompose
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type HealthCheck struct {
+	Test     []string
+	Interval time.Duration
+	Timeout  time.Duration
+	Retries  int
+}
+
+// SignalingHealthCheck is used for every signaling server, whose image is
+// known to ship curl. Computers are checked with StartOptions.Ready instead.
+var SignalingHealthCheck = &HealthCheck{
+	Test:     []string{"CMD", "curl", "-fsS", "http://localhost:8080/health"},
+	Interval: time.Second,
+	Timeout:  2 * time.Second,
+	Retries:  60,
+}
+
+func (h *HealthCheck) ToYML(indent string) string {
+	if h == nil {
+		return ""
+	}
+	test := make([]string, len(h.Test))
+	for i, arg := range h.Test {
+		test[i] = fmt.Sprintf("%q", arg)
+	}
+	return fmt.Sprintf("%shealthcheck:\n%s  test: [%s]\n%s  interval: %s\n%s  timeout: %s\n%s  retries: %d\n",
+		indent, indent, strings.Join(test, ", "), indent, h.Interval, indent, h.Timeout, indent, h.Retries)
+}
+
+type StartOptions struct {
+	// WaitReady makes Start return only once every container with a health
+	// check is healthy, every other container is running and Ready accepts
+	// every computer.
+	WaitReady    bool
+	ReadyTimeout time.Duration
+	// Ready, when set, is called for every computer whose container is
+	// running until it returns nil, e.g. once its agent answers /health.
+	Ready func(computer *Computer) error
+}
+
+type containerState struct {
+	Status string `json:"Status"`
+	Health *struct {
+		Status string `json:"Status"`
+		Log    []struct {
+			ExitCode int    `json:"ExitCode"`
+			Output   string `json:"Output"`
+		} `json:"Log"`
+	} `json:"Health"`
+}
+
+func (s *containerState) ready() (bool, error) {
+	if s.Status != "running" {
+		return false, fmt.Errorf("container is %s", s.Status)
+	}
+	if s.Health == nil {
+		return true, nil
+	}
+	switch s.Health.Status {
+	case "healthy":
+		return true, nil
+	case "unhealthy":
+		return false, fmt.Errorf("container is unhealthy: %s", s.lastCheck())
+	}
+	return false, nil
+}
+
+func (s *containerState) lastCheck() string {
+	if s.Health == nil || len(s.Health.Log) == 0 {
+		return "no health check ran"
+	}
+	last := s.Health.Log[len(s.Health.Log)-1]
+	return fmt.Sprintf("health check exited with %d: %s", last.ExitCode, strings.TrimSpace(last.Output))
+}
+
+func parseContainerStates(names []string, out []byte) (map[string]*containerState, error) {
+	states := map[string]*containerState{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for i := 0; scanner.Scan(); i++ {
+		if i >= len(names) {
+			return nil, fmt.Errorf("docker inspect returned more states than containers")
+		}
+		state := &containerState{}
+		err := json.Unmarshal(scanner.Bytes(), state)
+		if err != nil {
+			return nil, err
+		}
+		states[names[i]] = state
+	}
+	return states, scanner.Err()
+}
+
+func (setup *Setup) waitReady(opts StartOptions) error {
+	names := setup.ContainerNames()
+	computers := map[string]*Computer{}
+	for _, computer := range setup.Computers {
+		computers[computer.Name] = computer
+	}
+	deadline := time.Now().Add(opts.ReadyTimeout)
+	// pending holds why each container is not ready yet
+	pending := map[string]string{}
+	for {
+		args := append([]string{"docker", "inspect", "-f", "{{json .State}}"}, names...)
+		inspect := run(setup.tmpDir, runRequest{args: args})
+		if inspect.err != nil {
+			return inspect.err
+		}
+		states, err := parseContainerStates(names, inspect.stdout)
+		if err != nil {
+			return err
+		}
+		pending = map[string]string{}
+		for _, name := range names {
+			state, found := states[name]
+			if !found {
+				return &NotReadyError{Container: name, Err: fmt.Errorf("container not found")}
+			}
+			ready, err := state.ready()
+			if err != nil {
+				return &NotReadyError{Container: name, Err: err}
+			}
+			if !ready {
+				pending[name] = state.lastCheck()
+				continue
+			}
+			if computer, found := computers[name]; found && opts.Ready != nil {
+				err = opts.Ready(computer)
+				if err != nil {
+					pending[name] = err.Error()
+				}
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	for _, name := range names {
+		if reason, found := pending[name]; found {
+			return &NotReadyError{Container: name, Err: fmt.Errorf("not ready after %s, %s", opts.ReadyTimeout, reason)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package dockercompose
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseContainerStates(t *testing.T) {
+	out := []byte(`{"Status":"running","Health":{"Status":"healthy","Log":[]}}
+{"Status":"running","Health":{"Status":"starting","Log":[{"ExitCode":7,"Output":"curl: (7) Failed to connect to localhost port 8080\n"}]}}
+{"Status":"running"}
+{"Status":"exited"}
+`)
+	states, err := parseContainerStates([]string{"agent", "slow", "router", "crashed"}, out)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	ready, err := states["agent"].ready()
+	assert.True(t, ready)
+	assert.Nil(t, err)
+
+	ready, err = states["slow"].ready()
+	assert.False(t, ready)
+	assert.Nil(t, err)
+	assert.Equal(t, "health check exited with 7: curl: (7) Failed to connect to localhost port 8080", states["slow"].lastCheck())
+
+	ready, err = states["router"].ready()
+	assert.True(t, ready)
+	assert.Nil(t, err)
+
+	_, err = states["crashed"].ready()
+	assert.EqualError(t, err, "container is exited")
+
+	_, err = parseContainerStates([]string{"agent"}, out)
+	assert.NotNil(t, err)
+}
+
+func TestNotReadyError(t *testing.T) {
+	state := &containerState{Status: "running"}
+	err := &NotReadyError{Container: "setup_computer", Err: assert.AnError}
+	assert.Equal(t, "setup_computer is not ready: "+assert.AnError.Error(), err.Error())
+	assert.Equal(t, "no health check ran", state.lastCheck())
+}
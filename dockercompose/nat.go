@@ -0,0 +1,91 @@
+package dockercompose
+
+import (
+	"fmt"
+	"strings"
+)
+
+type NATType string
+
+const (
+	NATFullCone           NATType = "full-cone"
+	NATRestrictedCone     NATType = "restricted-cone"
+	NATPortRestrictedCone NATType = "port-restricted-cone"
+	NATSymmetric          NATType = "symmetric"
+	NATUDPBlocked         NATType = "udp-blocked"
+)
+
+var NATTypes = []NATType{NATFullCone, NATRestrictedCone, NATPortRestrictedCone, NATSymmetric, NATUDPBlocked}
+
+type natInterfaces struct {
+	lan   string
+	wan   string
+	wanIP string
+	host  string
+}
+
+func iptables(args ...string) []string {
+	return append([]string{"iptables"}, args...)
+}
+
+func natRules(nat NATType, ifs natInterfaces) ([][]string, error) {
+	rules := [][]string{}
+	if nat == NATUDPBlocked {
+		rules = append(rules, iptables("-A", "FORWARD", "-p", "udp", "-j", "DROP"))
+	}
+	rules = append(rules,
+		iptables("-A", "FORWARD", "-i", ifs.wan, "-o", ifs.lan, "-m", "state", "--state", "RELATED,ESTABLISHED", "-j", "ACCEPT"),
+	)
+	switch nat {
+	case NATPortRestrictedCone, NATUDPBlocked:
+		rules = append(rules,
+			iptables("-A", "FORWARD", "-i", ifs.lan, "-o", ifs.wan, "-j", "ACCEPT"),
+			iptables("-t", "nat", "-A", "POSTROUTING", "-o", ifs.wan, "-j", "MASQUERADE"),
+		)
+	case NATSymmetric:
+		rules = append(rules,
+			iptables("-A", "FORWARD", "-i", ifs.lan, "-o", ifs.wan, "-j", "ACCEPT"),
+			iptables("-t", "nat", "-A", "POSTROUTING", "-o", ifs.wan, "-j", "MASQUERADE", "--random"),
+		)
+	case NATFullCone:
+		if ifs.host == "" {
+			return nil, fmt.Errorf("a %s NAT needs a computer behind it", nat)
+		}
+		rules = append(rules,
+			iptables("-A", "FORWARD", "-i", ifs.lan, "-o", ifs.wan, "-j", "ACCEPT"),
+			iptables("-A", "FORWARD", "-i", ifs.wan, "-o", ifs.lan, "-p", "udp", "-d", ifs.host, "-j", "ACCEPT"),
+			iptables("-t", "nat", "-A", "POSTROUTING", "-o", ifs.wan, "-p", "udp", "-j", "SNAT", "--to-source", ifs.wanIP),
+			iptables("-t", "nat", "-A", "POSTROUTING", "-o", ifs.wan, "-j", "MASQUERADE"),
+			iptables("-t", "nat", "-A", "PREROUTING", "-i", ifs.wan, "-p", "udp", "-j", "DNAT", "--to-destination", ifs.host),
+		)
+	case NATRestrictedCone:
+		if ifs.host == "" {
+			return nil, fmt.Errorf("a %s NAT needs a computer behind it", nat)
+		}
+		// remember every address the computer sent packets to, and only let
+		// in packets coming from those addresses, whatever their port
+		rules = append(rules,
+			iptables("-A", "FORWARD", "-i", ifs.lan, "-o", ifs.wan, "-m", "recent", "--name", "contacted", "--rdest", "--set", "-j", "ACCEPT"),
+			iptables("-A", "FORWARD", "-i", ifs.wan, "-o", ifs.lan, "-p", "udp", "-d", ifs.host, "-m", "recent", "--name", "contacted", "--rsource", "--rcheck", "-j", "ACCEPT"),
+			iptables("-t", "nat", "-A", "POSTROUTING", "-o", ifs.wan, "-p", "udp", "-j", "SNAT", "--to-source", ifs.wanIP),
+			iptables("-t", "nat", "-A", "POSTROUTING", "-o", ifs.wan, "-j", "MASQUERADE"),
+			iptables("-t", "nat", "-A", "PREROUTING", "-i", ifs.wan, "-p", "udp", "-m", "recent", "--name", "contacted", "--rsource", "--rcheck", "-j", "DNAT", "--to-destination", ifs.host),
+		)
+	default:
+		return nil, fmt.Errorf("unknown NAT type %s", nat)
+	}
+	return rules, nil
+}
+
+func parseInterfaceAddresses(out []byte) map[string]string {
+	interfaces := map[string]string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		for i := 0; i+1 < len(fields); i++ {
+			if fields[i] == "inet" {
+				interfaces[strings.Split(fields[i+1], "/")[0]] = strings.TrimSuffix(strings.Split(fields[1], "@")[0], ":")
+			}
+		}
+	}
+	return interfaces
+}
@@ -0,0 +1,43 @@
+package dockercompose
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseInterfaceAddresses(t *testing.T) {
+	out := []byte(`1: lo    inet 127.0.0.1/8 scope host lo\       valid_lft forever preferred_lft forever
+52: eth0@if53    inet 172.19.0.3/16 brd 172.19.255.255 scope global eth0\       valid_lft forever preferred_lft forever
+54: eth1    inet 172.20.0.2/16 brd 172.20.255.255 scope global eth1\       valid_lft forever preferred_lft forever
+`)
+	assert.Equal(t, map[string]string{
+		"127.0.0.1":  "lo",
+		"172.19.0.3": "eth0",
+		"172.20.0.2": "eth1",
+	}, parseInterfaceAddresses(out))
+}
+
+func TestNATRules(t *testing.T) {
+	ifs := natInterfaces{lan: "eth1", wan: "eth0", wanIP: "172.19.0.3", host: "172.20.0.3"}
+	rules, err := natRules(NATPortRestrictedCone, ifs)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{
+		{"iptables", "-A", "FORWARD", "-i", "eth0", "-o", "eth1", "-m", "state", "--state", "RELATED,ESTABLISHED", "-j", "ACCEPT"},
+		{"iptables", "-A", "FORWARD", "-i", "eth1", "-o", "eth0", "-j", "ACCEPT"},
+		{"iptables", "-t", "nat", "-A", "POSTROUTING", "-o", "eth0", "-j", "MASQUERADE"},
+	}, rules)
+
+	rules, err = natRules(NATUDPBlocked, ifs)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"iptables", "-A", "FORWARD", "-p", "udp", "-j", "DROP"}, rules[0])
+
+	for _, nat := range NATTypes {
+		_, err = natRules(nat, ifs)
+		assert.Nil(t, err, string(nat))
+	}
+	_, err = natRules(NATFullCone, natInterfaces{lan: "eth1", wan: "eth0", wanIP: "172.19.0.3"})
+	assert.NotNil(t, err)
+	_, err = natRules("nonexistent", ifs)
+	assert.NotNil(t, err)
+}
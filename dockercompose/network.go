@@ -1,15 +1,49 @@
 package dockercompose
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+)
 
 type Network struct {
-	Name string
+	Name   string
+	Labels map[string]string
+	// Internal networks are not connected to the outside world.
+	Internal bool
+	// Multicast networks carry the multicast traffic, such as mDNS, of the
+	// computers in them, which then drop it on the management network when
+	// the setup has a ToolsImage. Routers never forward it to other networks.
+	Multicast bool
 }
 
 func newNetwork(name string) *Network {
-	return &Network{Name: name}
+	return &Network{Name: name, Labels: map[string]string{}}
+}
+
+func labelsToYML(labels map[string]string, indent string) string {
+	return mapToYML("labels", labels, indent)
+}
+
+func mapToYML(name string, values map[string]string, indent string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	yml := fmt.Sprintf("%s%s:\n", indent, name)
+	for _, key := range keys {
+		yml += fmt.Sprintf("%s  %s: %q\n", indent, key, values[key])
+	}
+	return yml
 }
 
 func (n *Network) ToYML() string {
-	return fmt.Sprintf("  %s:\n", n.Name)
+	yml := fmt.Sprintf("  %s:\n", n.Name) + labelsToYML(n.Labels, "    ")
+	if n.Internal {
+		yml += "    internal: true\n"
+	}
+	return yml
 }
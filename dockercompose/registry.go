@@ -0,0 +1,76 @@
+package dockercompose
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	liveMu sync.Mutex
+	live   = map[*Setup]struct{}{}
+)
+
+func register(s *Setup) {
+	liveMu.Lock()
+	defer liveMu.Unlock()
+	live[s] = struct{}{}
+}
+
+func unregister(s *Setup) {
+	liveMu.Lock()
+	defer liveMu.Unlock()
+	delete(live, s)
+}
+
+func LiveSetups() []*Setup {
+	liveMu.Lock()
+	defer liveMu.Unlock()
+	setups := make([]*Setup, 0, len(live))
+	for s := range live {
+		setups = append(setups, s)
+	}
+	sort.Slice(setups, func(i, j int) bool { return setups[i].ID < setups[j].ID })
+	return setups
+}
+
+func StopAll(grace time.Duration) error {
+	setups := LiveSetups()
+	if len(setups) == 0 {
+		return nil
+	}
+	log.Printf("stopping %d running setups", len(setups))
+	done := make(chan *Setup, len(setups))
+	for _, s := range setups {
+		go func(s *Setup) {
+			err := s.Stop()
+			if err != nil {
+				log.Printf("failed to stop setup %s: %s", s.ID, err.Error())
+			}
+			done <- s
+		}(s)
+	}
+
+	pending := map[*Setup]struct{}{}
+	for _, s := range setups {
+		pending[s] = struct{}{}
+	}
+	timeout := time.After(grace)
+	for len(pending) > 0 {
+		select {
+		case s := <-done:
+			delete(pending, s)
+		case <-timeout:
+			ids := []string{}
+			for s := range pending {
+				ids = append(ids, s.ID)
+			}
+			sort.Strings(ids)
+			return fmt.Errorf("setups still running after %s: %s", grace, strings.Join(ids, ", "))
+		}
+	}
+	return nil
+}
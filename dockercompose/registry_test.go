@@ -0,0 +1,25 @@
+package dockercompose
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	setup1 := NewSetup()
+	setup2 := NewSetup()
+	register(setup1)
+	register(setup2)
+	assert.Contains(t, LiveSetups(), setup1)
+	assert.Contains(t, LiveSetups(), setup2)
+
+	setup1.Keep()
+	assert.NotContains(t, LiveSetups(), setup1)
+	assert.Contains(t, LiveSetups(), setup2)
+
+	unregister(setup2)
+	assert.NotContains(t, LiveSetups(), setup2)
+	assert.Nil(t, StopAll(time.Second))
+}
@@ -1,26 +1,145 @@
 package dockercompose
 
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const routerCapturePath = "/tmp/vortices.pcap"
+
 type Router struct {
 	*BaseComputer
+	NAT NATType
 }
 
-func newRouter(setup *Setup, name, image string, networks []*Network) *Router {
+func newRouter(setup *Setup, name, image string, nat NATType, networks []*Network) *Router {
 	router := &Router{
 		BaseComputer: newBaseComputer(setup, name, image, networks),
+		NAT:          nat,
 	}
 	return router
 }
 
+func (router *Router) interfaceFor(interfaces map[string]string, network *Network) (string, string, error) {
+	ip, err := router.GetIPAddressForNetwork(network)
+	if err != nil {
+		return "", "", err
+	}
+	iface, found := interfaces[ip]
+	if !found {
+		return "", "", fmt.Errorf("no interface in %s has address %s", router.Name, ip)
+	}
+	return iface, ip, nil
+}
+
+func (router *Router) hostIn(network *Network) string {
+	for _, computer := range router.setup.Computers {
+		if computer.Gateway != router {
+			continue
+		}
+		ip, err := computer.GetIPAddressForNetwork(network)
+		if err == nil {
+			return ip
+		}
+	}
+	return ""
+}
+
 func (router *Router) Start() error {
-	for _, rr := range []runRequest{
-		runRequest{args: []string{"docker", "exec", "--privileged", router.Name, "iptables", "-A", "FORWARD", "-i", "eth0", "-o", "eth1", "-m", "state", "--state", "RELATED,ESTABLISHED", "-j", "ACCEPT"}},
-		runRequest{args: []string{"docker", "exec", "--privileged", router.Name, "iptables", "-A", "FORWARD", "-i", "eth1", "-o", "eth0", "-j", "ACCEPT"}},
-		runRequest{args: []string{"docker", "exec", "--privileged", router.Name, "iptables", "-t", "nat", "-A", "POSTROUTING", "-o", "eth0", "-j", "MASQUERADE"}},
-	} {
-		cmd := router.setup.exec(rr)
-		if cmd.err != nil {
-			return cmd.err
+	if len(router.Networks) < 2 {
+		return fmt.Errorf("router %s needs at least a LAN and a WAN network", router.Name)
+	}
+	addresses := router.setup.exec(runRequest{args: []string{"docker", "exec", router.Name, "ip", "-o", "-4", "addr", "show"}})
+	if addresses.err != nil {
+		return addresses.err
+	}
+	interfaces := parseInterfaceAddresses(addresses.stdout)
+	wan, wanIP, err := router.interfaceFor(interfaces, router.Networks[len(router.Networks)-1])
+	if err != nil {
+		return err
+	}
+	for _, network := range router.Networks[:len(router.Networks)-1] {
+		lan, _, err := router.interfaceFor(interfaces, network)
+		if err != nil {
+			return err
+		}
+		rules, err := natRules(router.NAT, natInterfaces{lan: lan, wan: wan, wanIP: wanIP, host: router.hostIn(network)})
+		if err != nil {
+			return err
 		}
+		for _, rule := range rules {
+			cmd := router.setup.exec(runRequest{args: append([]string{"docker", "exec", "--privileged", router.Name}, rule...)})
+			if cmd.err != nil {
+				return cmd.err
+			}
+		}
+	}
+	capture := router.setup.exec(runRequest{args: []string{"docker", "exec", "-d", "--privileged", router.Name, "tcpdump", "-i", "any", "-U", "-w", routerCapturePath}})
+	if capture.err != nil {
+		log.Printf("could not capture packets in router %s: %s", router.Name, capture.err.Error())
 	}
 	return nil
 }
+
+// Capture records the packets matching a tcpdump filter that cross an
+// interface of a container, e.g. to check what a router forwards.
+type Capture struct {
+	container *BaseComputer
+	path      string
+}
+
+func captureArgs(container, iface, path, filter string) []string {
+	return append([]string{"docker", "exec", "-d", "--privileged", container, "tcpdump", "-i", iface, "-U", "-w", path}, strings.Fields(filter)...)
+}
+
+func (router *Router) Capture(network *Network, filter string) (*Capture, error) {
+	addresses := router.setup.exec(runRequest{args: []string{"docker", "exec", router.Name, "ip", "-o", "-4", "addr", "show"}})
+	if addresses.err != nil {
+		return nil, addresses.err
+	}
+	iface, _, err := router.interfaceFor(parseInterfaceAddresses(addresses.stdout), network)
+	if err != nil {
+		return nil, err
+	}
+	return router.startCapture(iface, network, filter)
+}
+
+// startCapture runs tcpdump on iface, which must be in network, in the
+// container, whose image needs tcpdump.
+func (comp *BaseComputer) startCapture(iface string, network *Network, filter string) (*Capture, error) {
+	c := &Capture{container: comp, path: fmt.Sprintf("/tmp/vortices-%s.pcap", network.Name)}
+	start := comp.setup.exec(runRequest{args: captureArgs(comp.Name, iface, c.path, filter)})
+	if start.err != nil {
+		return nil, start.err
+	}
+	// tcpdump is detached, wait until it opened its file so that no packet
+	// sent afterwards is missed
+	for i := 0; i < 50; i++ {
+		if comp.setup.exec(runRequest{args: []string{"docker", "exec", comp.Name, "test", "-e", c.path}}).err == nil {
+			return c, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil, fmt.Errorf("tcpdump did not start capturing %s in %s", network.Name, comp.Name)
+}
+
+// Packets returns a line per packet captured so far, as printed by tcpdump.
+func (c *Capture) Packets() ([]string, error) {
+	read := c.container.setup.exec(runRequest{args: []string{"docker", "exec", c.container.Name, "tcpdump", "-nn", "-r", c.path}})
+	if read.err != nil {
+		return nil, read.err
+	}
+	return parsePacketLines(read.stdout), nil
+}
+
+func parsePacketLines(out []byte) []string {
+	packets := []string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.TrimSpace(line) != "" {
+			packets = append(packets, line)
+		}
+	}
+	return packets
+}
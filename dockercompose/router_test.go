@@ -0,0 +1,21 @@
+package dockercompose
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureArgs(t *testing.T) {
+	assert.Equal(t, []string{
+		"docker", "exec", "-d", "--privileged", "setup_router", "tcpdump", "-i", "eth1", "-U", "-w", "/tmp/vortices-lan.pcap",
+		"udp", "port", "5353",
+	}, captureArgs("setup_router", "eth1", "/tmp/vortices-lan.pcap", "udp port 5353"))
+}
+
+func TestParsePacketLines(t *testing.T) {
+	assert.Equal(t, []string{
+		"12:00:00.000000 IP 10.0.0.2.5353 > 224.0.0.251.5353: 0 A (QM)? 3c9f2b1e.local. (35)",
+	}, parsePacketLines([]byte("12:00:00.000000 IP 10.0.0.2.5353 > 224.0.0.251.5353: 0 A (QM)? 3c9f2b1e.local. (35)\n\n")))
+	assert.Equal(t, []string{}, parsePacketLines(nil))
+}
@@ -2,24 +2,76 @@ package dockercompose
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type Setup struct {
 	ID          string
+	Created     time.Time
+	ArtifactDir string
 	tmpDir      string
 	Computers   []*Computer
 	STUNServers []*STUNServer
+	TURNServers []*TURNServer
 	Routers     []*Router
 	Networks    []*Network
+
+	SignalingServers []*SignalingServer
+	Sniffers         []*Sniffer
+	// Management is attached to every computer so the runner can reach its
+	// agent without going through the networks under test.
+	Management *Network
+	// ToolsImage has ip, iptables and tcpdump, like the router image. When
+	// set, computers of setups with a Multicast network get multicast dropped
+	// on their management network, from ToolsImage run in their network
+	// namespace as their own image may lack iptables.
+	ToolsImage string
+
+	artifactsMu sync.Mutex
+	artifacts   *artifacts
+
+	stopMu  sync.Mutex
+	stopped bool
 }
 
 func NewSetup() *Setup {
-	return &Setup{ID: uuid.New().String(), Computers: []*Computer{}, Networks: []*Network{}, Routers: []*Router{}}
+	id := uuid.New().String()
+	s := &Setup{ID: id, Created: time.Now().UTC(), ArtifactDir: path.Join(artifactsRoot(), id), Computers: []*Computer{}, Networks: []*Network{}, Routers: []*Router{}}
+	s.Management = newNetwork(s.makeName("management"))
+	s.Management.Labels = s.labels()
+	s.Management.Internal = true
+	return s
+}
+
+func (s *Setup) labels() map[string]string {
+	return map[string]string{
+		setupLabel:   s.ID,
+		createdLabel: s.Created.Format(time.RFC3339),
+	}
+}
+
+func (s *Setup) getArtifacts() *artifacts {
+	s.artifactsMu.Lock()
+	defer s.artifactsMu.Unlock()
+	if s.artifacts == nil {
+		s.artifacts = newArtifacts(s.ArtifactDir, s.ID)
+	}
+	return s.artifacts
+}
+
+func (s *Setup) Artifacts() ArtifactIndex {
+	return s.getArtifacts().snapshot()
+}
+
+func (s *Setup) SaveArtifact(kind, name string, data []byte) (string, error) {
+	return s.getArtifacts().saveFile(kind, name, data)
 }
 
 func (s *Setup) makeName(name string) string {
@@ -27,18 +79,27 @@ func (s *Setup) makeName(name string) string {
 }
 func (s *Setup) NewNetwork(name string) *Network {
 	network := newNetwork(s.makeName(name))
+	network.Labels = s.labels()
 	s.Networks = append(s.Networks, network)
 	return network
 }
 
 func (s *Setup) NewComputer(name, image string, gateway *Router, networks []*Network) *Computer {
 	computer := newComputer(s, name, image, gateway, networks)
+	computer.Management = s.Management
+	for _, server := range s.SignalingServers {
+		computer.setEnvironment(server.Environment())
+	}
 	s.Computers = append(s.Computers, computer)
 	return computer
 }
 
 func (s *Setup) NewRouter(name, image string, networks []*Network) *Router {
-	router := newRouter(s, name, image, networks)
+	return s.NewNATRouter(name, image, NATPortRestrictedCone, networks)
+}
+
+func (s *Setup) NewNATRouter(name, image string, nat NATType, networks []*Network) *Router {
+	router := newRouter(s, name, image, nat, networks)
 	s.Routers = append(s.Routers, router)
 	return router
 }
@@ -49,6 +110,42 @@ func (s *Setup) NewSTUNServer(name string, networks []*Network) *STUNServer {
 	return stunServer
 }
 
+func (s *Setup) NewTURNServer(name string, networks []*Network) *TURNServer {
+	turnServer := newTURNServer(s, name, networks)
+	s.TURNServers = append(s.TURNServers, turnServer)
+	return turnServer
+}
+
+// NewSignalingServer adds a signaling server running image. Computers are
+// told where to find it through VORTICES_SIGNALING_URL and, if they are not
+// in any of its networks, can still resolve its name.
+func (s *Setup) NewSignalingServer(name, image string, networks []*Network) *SignalingServer {
+	server := newSignalingServer(s, name, image, networks)
+	for _, computer := range s.Computers {
+		computer.setEnvironment(server.Environment())
+	}
+	s.SignalingServers = append(s.SignalingServers, server)
+	return server
+}
+
+// NewSniffer adds a container running image, which needs tcpdump, to capture
+// the traffic of network, which can be the management network.
+func (s *Setup) NewSniffer(name, image string, network *Network) *Sniffer {
+	sniffer := newSniffer(s, name, image, network)
+	s.Sniffers = append(s.Sniffers, sniffer)
+	return sniffer
+}
+
+// multicast is whether any network of the setup carries multicast.
+func (s *Setup) multicast() bool {
+	for _, network := range s.Networks {
+		if network.Multicast {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Setup) ToYML() string {
 	yml := `
 version: "2.1"
@@ -60,35 +157,85 @@ services:
 	for _, comp := range s.STUNServers {
 		yml += comp.ToYML()
 	}
+	for _, comp := range s.TURNServers {
+		yml += comp.ToYML()
+	}
+	for _, comp := range s.SignalingServers {
+		yml += comp.ToYML()
+	}
 	for _, comp := range s.Routers {
 		yml += comp.ToYML()
 	}
+	for _, comp := range s.Sniffers {
+		yml += comp.ToYML()
+	}
 	yml += "networks:\n"
 	for _, network := range s.Networks {
 		yml += network.ToYML()
 	}
+	for _, comp := range s.baseComputers() {
+		if comp.Management == s.Management {
+			yml += s.Management.ToYML()
+			break
+		}
+	}
 	return yml
 }
 
+func setupDir(id string) string {
+	return path.Join(os.TempDir(), "vortices", id)
+}
+
+func (s *Setup) ContainerNames() []string {
+	names := []string{}
+	for _, comp := range s.baseComputers() {
+		names = append(names, comp.Name)
+	}
+	return names
+}
+
 func (setup *Setup) Start() error {
-	setup.tmpDir = path.Join(os.TempDir(), "vortices", setup.ID)
+	return setup.StartWithOptions(StartOptions{})
+}
+
+func (setup *Setup) StartWithOptions(opts StartOptions) error {
+	setup.tmpDir = setupDir(setup.ID)
 	err := os.MkdirAll(setup.tmpDir, 0744)
 	if err != nil {
 		return err
 	}
+	err = ioutil.WriteFile(path.Join(setup.tmpDir, "artifacts"), []byte(setup.ArtifactDir), 0644)
+	if err != nil {
+		return err
+	}
+	register(setup)
 	f, err := os.Create(path.Join(setup.tmpDir, "docker-compose.yml"))
 	if err != nil {
 		return err
 	}
-	_, err = f.WriteString(setup.ToYML())
+	yml := setup.ToYML()
+	_, err = f.WriteString(yml)
 	if err != nil {
 		return err
 	}
 	f.Close()
+	_, err = setup.SaveArtifact("compose", "docker-compose.yml", []byte(yml))
+	if err != nil {
+		log.Printf("failed to save docker-compose.yml in %s: %s", setup.ArtifactDir, err.Error())
+	}
 
 	cmd := setup.exec(runRequest{args: []string{"docker-compose", "up", "-d"}})
 	if cmd.err != nil {
-		log.Fatalf("failed to start docker-compose")
+		setup.Stop()
+		return &ComposeError{SetupID: setup.ID, Action: "up", Err: cmd.err}
+	}
+
+	if opts.WaitReady {
+		err = setup.waitReady(opts)
+		if err != nil {
+			setup.Stop()
+			return err
+		}
 	}
 
 	for _, computer := range setup.Computers {
@@ -110,14 +257,95 @@ func (setup *Setup) Start() error {
 	return nil
 }
 
+func (setup *Setup) collectArtifacts() {
+	save := func(kind, name string, rr runResponse) {
+		if rr.err != nil {
+			return
+		}
+		_, err := setup.SaveArtifact(kind, name, append(rr.stdout, rr.stderr...))
+		if err != nil {
+			log.Printf("failed to save %s for %s: %s", kind, name, err.Error())
+		}
+	}
+	for _, comp := range setup.baseComputers() {
+		save("logs", comp.Name, setup.exec(runRequest{args: []string{"docker", "logs", "--timestamps", comp.Name}}))
+	}
+	for _, computer := range setup.Computers {
+		save("routes", computer.Name, setup.exec(runRequest{args: []string{"docker", "exec", computer.Name, "ip", "route"}}))
+	}
+	for _, server := range setup.SignalingServers {
+		save("signaling", server.Name+".jsonl", setup.exec(runRequest{args: []string{"docker", "exec", server.Name, "cat", signalingLogPath}}))
+	}
+	for _, router := range setup.Routers {
+		save("routes", router.Name, setup.exec(runRequest{args: []string{"docker", "exec", router.Name, "ip", "route"}}))
+		save("iptables", router.Name, setup.exec(runRequest{args: []string{"docker", "exec", "--privileged", router.Name, "iptables-save", "-c"}}))
+		capture := setup.exec(runRequest{args: []string{"docker", "exec", router.Name, "cat", routerCapturePath}})
+		if capture.err == nil {
+			_, err := setup.SaveArtifact("pcap", router.Name+".pcap", capture.stdout)
+			if err != nil {
+				log.Printf("failed to save packet capture for %s: %s", router.Name, err.Error())
+			}
+		}
+	}
+}
+
+func (setup *Setup) baseComputers() []*BaseComputer {
+	comps := []*BaseComputer{}
+	for _, comp := range setup.Computers {
+		comps = append(comps, comp.BaseComputer)
+	}
+	for _, comp := range setup.STUNServers {
+		comps = append(comps, comp.BaseComputer)
+	}
+	for _, comp := range setup.TURNServers {
+		comps = append(comps, comp.BaseComputer)
+	}
+	for _, comp := range setup.SignalingServers {
+		comps = append(comps, comp.BaseComputer)
+	}
+	for _, comp := range setup.Routers {
+		comps = append(comps, comp.BaseComputer)
+	}
+	for _, comp := range setup.Sniffers {
+		comps = append(comps, comp.BaseComputer)
+	}
+	return comps
+}
+
+func (setup *Setup) Keep() {
+	unregister(setup)
+}
+
 func (setup *Setup) Stop() error {
+	setup.stopMu.Lock()
+	defer setup.stopMu.Unlock()
+	if setup.stopped {
+		return nil
+	}
+	setup.collectArtifacts()
 	cmd := setup.exec(runRequest{args: []string{"docker-compose", "down"}})
 	if cmd.err != nil {
-		return cmd.err
+		return &ComposeError{SetupID: setup.ID, Action: "down", Err: cmd.err}
 	}
+	setup.stopped = true
+	unregister(setup)
 	err := os.RemoveAll(setup.tmpDir)
 	if err != nil {
 		return err
 	}
+	log.Printf("artifacts for setup %s kept in %s", setup.ID, setup.ArtifactDir)
 	return nil
 }
+
+func Down(id string) error {
+	dir := setupDir(id)
+	if _, err := os.Stat(path.Join(dir, "docker-compose.yml")); os.IsNotExist(err) {
+		return fmt.Errorf("setup %s not found in %s", id, dir)
+	}
+	setup := &Setup{ID: id, ArtifactDir: path.Join(artifactsRoot(), id), tmpDir: dir}
+	artifactDir, err := ioutil.ReadFile(path.Join(dir, "artifacts"))
+	if err == nil && len(artifactDir) > 0 {
+		setup.ArtifactDir = string(artifactDir)
+	}
+	return setup.Stop()
+}
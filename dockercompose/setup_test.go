@@ -3,6 +3,7 @@ package dockercompose
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -15,19 +16,45 @@ func TestSetupYMLTwoNetworks(t *testing.T) {
 		network1,
 		network2,
 	}).ToYML()
+	created := setup.Created.Format(time.RFC3339)
 	assert.Equal(t, setup.ToYML(), fmt.Sprintf(`
 version: "2.1"
 services:
   %s_computer:
     container_name: %s_computer
     image: ubuntu
+    labels:
+      vortices.created: "%s"
+      vortices.setup: "%s"
     networks:
       %s_network1:
       %s_network2:
+      %s_management:
 
 
 networks:
   %s_network1:
+    labels:
+      vortices.created: "%s"
+      vortices.setup: "%s"
   %s_network2:
-`, setup.ID, setup.ID, setup.ID, setup.ID, setup.ID, setup.ID))
+    labels:
+      vortices.created: "%s"
+      vortices.setup: "%s"
+  %s_management:
+    labels:
+      vortices.created: "%s"
+      vortices.setup: "%s"
+    internal: true
+`, setup.ID, setup.ID, created, setup.ID, setup.ID, setup.ID, setup.ID,
+		setup.ID, created, setup.ID, setup.ID, created, setup.ID, setup.ID, created, setup.ID))
+}
+
+func TestParseIPAddresses(t *testing.T) {
+	setup := NewSetup()
+	computer := setup.NewComputer("computer", "ubuntu", nil, []*Network{setup.NewNetwork("network1")})
+	out := []byte(fmt.Sprintf("%s_%s_management 172.30.0.2\n%s_%s_network1 172.31.0.2\n", setup.ID, setup.ID, setup.ID, setup.ID))
+	assert.Equal(t, []string{"172.31.0.2"}, computer.parseIPAddresses(out))
+	computer.Management = nil
+	assert.Equal(t, []string{"172.30.0.2", "172.31.0.2"}, computer.parseIPAddresses(out))
 }
@@ -0,0 +1,90 @@
+package dockercompose
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	SignalingPort    = 8080
+	signalingLogPath = "/var/log/vortices-signaling.jsonl"
+)
+
+// SignalingServer relays messages between the agents of a setup. Each setup
+// uses its own room, named after the setup ID.
+type SignalingServer struct {
+	*BaseComputer
+}
+
+type SignalingMessage struct {
+	ID      int             `json:"id"`
+	Time    time.Time       `json:"time"`
+	Room    string          `json:"room"`
+	From    string          `json:"from"`
+	To      string          `json:"to,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+func newSignalingServer(setup *Setup, name, image string, networks []*Network) *SignalingServer {
+	server := &SignalingServer{BaseComputer: newBaseComputer(setup, name, image, networks)}
+	server.HealthCheck = SignalingHealthCheck
+	return server
+}
+
+func (s *SignalingServer) URL() string {
+	return fmt.Sprintf("http://%s:%d", s.Name, SignalingPort)
+}
+
+// Environment is what computers get to find the signaling server.
+func (s *SignalingServer) Environment() map[string]string {
+	return map[string]string{
+		"VORTICES_SETUP_ID":       s.setup.ID,
+		"VORTICES_SIGNALING_URL":  s.URL(),
+		"VORTICES_SIGNALING_ROOM": s.setup.ID,
+	}
+}
+
+// Log returns the messages relayed in the setup's room so far.
+func (s *SignalingServer) Log() ([]*SignalingMessage, error) {
+	logExec := s.setup.exec(runRequest{args: []string{"docker", "exec", s.Name, "cat", signalingLogPath}})
+	if logExec.err != nil {
+		return nil, logExec.err
+	}
+	return parseSignalingLog(logExec.stdout, s.setup.ID)
+}
+
+func parseSignalingLog(out []byte, room string) ([]*SignalingMessage, error) {
+	messages := []*SignalingMessage{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		m := &SignalingMessage{}
+		err := json.Unmarshal(scanner.Bytes(), m)
+		if err != nil {
+			return nil, fmt.Errorf("signaling log line %d: %s", line, err.Error())
+		}
+		if m.Room == room {
+			messages = append(messages, m)
+		}
+	}
+	return messages, scanner.Err()
+}
+
+// FilterSignalingMessages returns the messages of the given type, sent by the given peer
+// when from is not empty.
+func FilterSignalingMessages(messages []*SignalingMessage, from, messageType string) []*SignalingMessage {
+	filtered := []*SignalingMessage{}
+	for _, m := range messages {
+		if m.Type == messageType && (from == "" || m.From == from) {
+			filtered = append(filtered, m)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,44 @@
+package dockercompose
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignalingEnvironment(t *testing.T) {
+	setup := NewSetup()
+	internet := setup.NewNetwork("internet")
+	before := setup.NewComputer("computer", "ubuntu", nil, []*Network{internet})
+	server := setup.NewSignalingServer("signaling", "vortices-signaling", []*Network{internet})
+	after := setup.NewComputer("computer2", "ubuntu", nil, []*Network{internet})
+
+	url := "http://" + setup.ID + "_signaling:8080"
+	assert.Equal(t, url, server.URL())
+	for _, computer := range []*Computer{before, after} {
+		assert.Equal(t, url, computer.Environment["VORTICES_SIGNALING_URL"])
+		assert.Equal(t, setup.ID, computer.Environment["VORTICES_SIGNALING_ROOM"])
+		assert.Contains(t, computer.ToYML(), "    environment:\n      VORTICES_SETUP_ID: \""+setup.ID+"\"\n")
+	}
+	assert.Contains(t, setup.ToYML(), "  "+setup.ID+"_signaling:\n")
+	assert.Contains(t, setup.ContainerNames(), server.Name)
+}
+
+func TestParseSignalingLog(t *testing.T) {
+	messages, err := parseSignalingLog([]byte(`{"id":1,"room":"a","from":"computer","type":"offer","payload":{"ufrag":"x"}}
+{"id":1,"room":"b","from":"other","type":"offer"}
+
+{"id":2,"room":"a","from":"computer2","to":"computer","type":"answer"}
+{"id":3,"room":"a","from":"computer","type":"candidate","payload":"host 10.0.0.2:5000"}
+`), "a")
+	assert.Nil(t, err)
+	assert.Len(t, messages, 3)
+	assert.Equal(t, "computer2", messages[1].From)
+	assert.Equal(t, "computer", messages[1].To)
+	assert.Equal(t, `{"ufrag":"x"}`, string(messages[0].Payload))
+	assert.Len(t, FilterSignalingMessages(messages, "computer", "candidate"), 1)
+	assert.Len(t, FilterSignalingMessages(messages, "", "offer"), 1)
+
+	_, err = parseSignalingLog([]byte("{\n"), "a")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,25 @@
+package dockercompose
+
+// Sniffer is a container in a single network that only captures its traffic,
+// for networks no router is in, such as the management network.
+type Sniffer struct {
+	*BaseComputer
+	network *Network
+}
+
+func newSniffer(setup *Setup, name, image string, network *Network) *Sniffer {
+	sniffer := &Sniffer{BaseComputer: newBaseComputer(setup, name, image, nil), network: network}
+	if network == setup.Management {
+		sniffer.Management = network
+	} else {
+		sniffer.Networks = []*Network{network}
+	}
+	sniffer.Command = []string{"sleep", "infinity"}
+	return sniffer
+}
+
+// Capture records the packets matching a tcpdump filter in the sniffer's
+// network.
+func (s *Sniffer) Capture(filter string) (*Capture, error) {
+	return s.startCapture("any", s.network, filter)
+}
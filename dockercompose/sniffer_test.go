@@ -0,0 +1,30 @@
+package dockercompose
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnifferYML(t *testing.T) {
+	setup := NewSetup()
+	lan := setup.NewSniffer("lan-sniffer", "router", setup.NewNetwork("lan"))
+	management := setup.NewSniffer("management-sniffer", "router", setup.Management)
+	created := setup.Created.Format(time.RFC3339)
+	assert.Equal(t, fmt.Sprintf(`  %s_lan-sniffer:
+    container_name: %s_lan-sniffer
+    image: router
+    command: ["sleep", "infinity"]
+    labels:
+      vortices.created: "%s"
+      vortices.setup: "%s"
+    networks:
+      %s_lan:
+
+
+`, setup.ID, setup.ID, created, setup.ID, setup.ID), lan.ToYML())
+	assert.Contains(t, management.ToYML(), fmt.Sprintf("    networks:\n      %s_management:\n", setup.ID))
+	assert.Contains(t, setup.ToYML(), fmt.Sprintf("  %s_management:\n", setup.ID))
+}
@@ -1,5 +1,9 @@
 package dockercompose
 
+import "fmt"
+
+const STUNPort = 3478
+
 type STUNServer struct {
 	*BaseComputer
 }
@@ -7,3 +11,12 @@ type STUNServer struct {
 func newSTUNServer(setup *Setup, name string, networks []*Network) *STUNServer {
 	return &STUNServer{BaseComputer: newBaseComputer(setup, name, "gortc/gortcd", networks)}
 }
+
+// URL returns the stun: URL of the server.
+func (s *STUNServer) URL() (string, error) {
+	ip, err := s.GetIPAddress()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("stun:%s:%d", ip, STUNPort), nil
+}
@@ -0,0 +1,82 @@
+package dockercompose
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+type execTransport struct {
+	comp  *BaseComputer
+	local bool
+}
+
+// ExecTransport sends HTTP requests to a server listening inside the
+// container by running curl through docker exec, so the container does not
+// need to be reachable from the host.
+func (comp *BaseComputer) ExecTransport() http.RoundTripper {
+	return &execTransport{comp: comp, local: true}
+}
+
+// ExecOutboundTransport sends HTTP requests from inside the container to the
+// host they are addressed to, resolving and routing it as the container
+// would, e.g. through its router.
+func (comp *BaseComputer) ExecOutboundTransport() http.RoundTripper {
+	return &execTransport{comp: comp}
+}
+
+func execTransportArgs(container string, req *http.Request, hasBody, local bool) []string {
+	args := []string{"docker", "exec", "-i", container, "curl", "-sS", "-i", "--raw", "-X", req.Method, "-H", "Expect:"}
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range req.Header[name] {
+			args = append(args, "-H", name+": "+value)
+		}
+	}
+	if hasBody {
+		args = append(args, "--data-binary", "@-")
+	}
+	u := url.URL{Scheme: "http", Host: req.URL.Host, Path: req.URL.Path, RawQuery: req.URL.RawQuery}
+	if local {
+		port := req.URL.Port()
+		if port == "" {
+			port = "80"
+		}
+		u.Host = "localhost:" + port
+	}
+	return append(args, u.String())
+}
+
+func (t *execTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	rr := t.comp.setup.exec(runRequest{
+		args:  execTransportArgs(t.comp.Name, req, body != nil, t.local),
+		stdin: body,
+		ctx:   req.Context(),
+	})
+	if rr.err != nil {
+		return nil, rr.err
+	}
+	return readExecResponse(rr.stdout, req)
+}
+
+// readExecResponse parses the output of curl -i --raw, whose body is still
+// chunked when the headers say so.
+func readExecResponse(out []byte, req *http.Request) (*http.Response, error) {
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(out)), req)
+}
@@ -0,0 +1,53 @@
+package dockercompose
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecTransportArgs(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "http://computer:8080/ping?x=1", strings.NewReader("ip=10.0.0.2"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	assert.Equal(t, []string{
+		"docker", "exec", "-i", "setup_computer", "curl", "-sS", "-i", "--raw", "-X", "POST", "-H", "Expect:",
+		"-H", "Content-Type: application/x-www-form-urlencoded",
+		"--data-binary", "@-",
+		"http://localhost:8080/ping?x=1",
+	}, execTransportArgs("setup_computer", req, true, true))
+}
+
+func TestExecOutboundTransportArgs(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://setup_signaling:8080/rooms/setup/log", nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, []string{
+		"docker", "exec", "-i", "setup_computer", "curl", "-sS", "-i", "--raw", "-X", "GET", "-H", "Expect:",
+		"http://setup_signaling:8080/rooms/setup/log",
+	}, execTransportArgs("setup_computer", req, false, false))
+}
+
+func TestReadExecResponseChunked(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "http://computer:8080/ice/offer", nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	out := "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"6\r\n{\"ufra\r\n" + "a\r\ng\":\"abcd\"}\r\n" + "0\r\n\r\n"
+	res, err := readExecResponse([]byte(out), req)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"ufrag":"abcd"}`, string(body))
+	assert.Equal(t, []string{"chunked"}, res.TransferEncoding)
+}
@@ -0,0 +1,60 @@
+package dockercompose
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	TURNPort     = 3478
+	turnUsername = "vortices"
+	turnPassword = "vortices"
+	turnRealm    = "vortices"
+)
+
+// TURNServer is a coturn relay accepting a single long term credential.
+type TURNServer struct {
+	*BaseComputer
+	Username string
+	Password string
+	Realm    string
+}
+
+func newTURNServer(setup *Setup, name string, networks []*Network) *TURNServer {
+	server := &TURNServer{
+		BaseComputer: newBaseComputer(setup, name, "coturn/coturn", networks),
+		Username:     turnUsername,
+		Password:     turnPassword,
+		Realm:        turnRealm,
+	}
+	server.Command = []string{
+		"-n", "--log-file=stdout", "--no-cli", "--no-tls", "--no-dtls", "--fingerprint",
+		fmt.Sprintf("--listening-port=%d", TURNPort),
+		"--lt-cred-mech",
+		"--realm=" + server.Realm,
+		fmt.Sprintf("--user=%s:%s", server.Username, server.Password),
+	}
+	server.HealthCheck = turnHealthCheck()
+	return server
+}
+
+// turnHealthCheck waits for coturn to listen on its UDP port, looked up in
+// /proc/net/udp so it only needs grep in the image, so setups waiting to be
+// ready do not gather candidates before the relay can answer.
+func turnHealthCheck() *HealthCheck {
+	return &HealthCheck{
+		Test:     []string{"CMD", "grep", "-qi", fmt.Sprintf(":%04X ", TURNPort), "/proc/net/udp"},
+		Interval: time.Second,
+		Timeout:  2 * time.Second,
+		Retries:  60,
+	}
+}
+
+// URL returns the turn: URL of the server, over UDP.
+func (s *TURNServer) URL() (string, error) {
+	ip, err := s.GetIPAddress()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("turn:%s:%d?transport=udp", ip, TURNPort), nil
+}
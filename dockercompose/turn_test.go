@@ -0,0 +1,19 @@
+package dockercompose
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTURNServerYML(t *testing.T) {
+	setup := NewSetup()
+	internet := setup.NewNetwork("internet")
+	server := setup.NewTURNServer("turn-server", []*Network{internet})
+	yml := setup.ToYML()
+	assert.Contains(t, yml, "  "+setup.ID+"_turn-server:\n    container_name: "+setup.ID+"_turn-server\n    image: coturn/coturn\n")
+	assert.Contains(t, yml, `    command: ["-n", "--log-file=stdout", "--no-cli", "--no-tls", "--no-dtls", "--fingerprint", "--listening-port=3478", "--lt-cred-mech", "--realm=vortices", "--user=vortices:vortices"]`+"\n")
+	assert.Contains(t, setup.ContainerNames(), server.Name)
+	assert.Contains(t, yml, `      test: ["CMD", "grep", "-qi", ":0D96 ", "/proc/net/udp"]`+"\n")
+	assert.NotNil(t, server.HealthCheck)
+}
@@ -1,9 +1,30 @@
 module github.com/seppo0010/vortices/examples/pion
 
-go 1.12
+go 1.19
 
 require (
-	github.com/pion/ice v0.5.12
-	github.com/pion/stun v0.3.1
+	github.com/pion/ice/v2 v2.3.38
+	github.com/pion/stun v0.6.1
+	github.com/seppo0010/vortices v0.0.0-00010101000000-000000000000
 	github.com/sparrc/go-ping v0.0.0-20190613174326-4e5b6552494c
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/google/uuid v1.3.1 // indirect
+	github.com/pion/dtls/v2 v2.2.7 // indirect
+	github.com/pion/logging v0.2.2 // indirect
+	github.com/pion/mdns v0.0.12 // indirect
+	github.com/pion/randutil v0.1.0 // indirect
+	github.com/pion/transport/v2 v2.2.10 // indirect
+	github.com/pion/turn/v2 v2.1.3 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/stretchr/testify v1.8.4 // indirect
+	github.com/wlynxg/anet v0.0.3 // indirect
+	golang.org/x/crypto v0.18.0 // indirect
+	golang.org/x/net v0.20.0 // indirect
+	golang.org/x/sys v0.16.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/seppo0010/vortices => ../..
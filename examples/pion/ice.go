@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/ice/v2"
+	protocol "github.com/seppo0010/vortices/agent"
+)
+
+type iceSession struct {
+	mu             sync.Mutex
+	agent          *ice.Agent
+	controlling    bool
+	created        time.Time
+	remote         *protocol.ICEDescription
+	started        bool
+	state          string
+	local          *protocol.Candidate
+	remotePair     *protocol.Candidate
+	err            string
+	connectedAfter time.Duration
+
+	// trickled candidates, with changed closed and replaced whenever one is
+	// added or gathering finishes
+	candidates []*protocol.ICECandidateEvent
+	gathered   bool
+	changed    chan struct{}
+}
+
+var (
+	iceMu      sync.Mutex
+	iceCurrent *iceSession
+)
+
+func newICECandidate(c ice.Candidate) *protocol.Candidate {
+	candidate := &protocol.Candidate{
+		Type:       c.Type().String(),
+		Protocol:   c.NetworkType().NetworkShort(),
+		Address:    c.Address(),
+		Port:       c.Port(),
+		Component:  int(c.Component()),
+		Priority:   c.Priority(),
+		Foundation: c.Foundation(),
+		TCPType:    c.TCPType().String(),
+	}
+	if related := c.RelatedAddress(); related != nil {
+		candidate.RelatedAddress = related.Address
+		candidate.RelatedPort = related.Port
+	}
+	return candidate
+}
+
+func toICE(c *protocol.Candidate) (ice.Candidate, error) {
+	component := uint16(c.Component)
+	switch c.Type {
+	case protocol.CandidateTypeHost:
+		return ice.NewCandidateHost(&ice.CandidateHostConfig{Network: c.Protocol, Address: c.Address, Port: c.Port, Component: component, TCPType: ice.NewTCPType(c.TCPType)})
+	case protocol.CandidateTypeSrflx:
+		return ice.NewCandidateServerReflexive(&ice.CandidateServerReflexiveConfig{Network: c.Protocol, Address: c.Address, Port: c.Port, Component: component, RelAddr: c.RelatedAddress, RelPort: c.RelatedPort})
+	case protocol.CandidateTypePrflx:
+		return ice.NewCandidatePeerReflexive(&ice.CandidatePeerReflexiveConfig{Network: c.Protocol, Address: c.Address, Port: c.Port, Component: component, RelAddr: c.RelatedAddress, RelPort: c.RelatedPort})
+	case protocol.CandidateTypeRelay:
+		return ice.NewCandidateRelay(&ice.CandidateRelayConfig{Network: c.Protocol, Address: c.Address, Port: c.Port, Component: component, RelAddr: c.RelatedAddress, RelPort: c.RelatedPort})
+	}
+	return nil, fmt.Errorf("unknown candidate type %q", c.Type)
+}
+
+func (s *iceSession) addCandidate(c *protocol.Candidate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c == nil {
+		s.gathered = true
+	} else {
+		s.candidates = append(s.candidates, &protocol.ICECandidateEvent{Index: len(s.candidates) + 1, Elapsed: time.Since(s.created).Seconds(), Candidate: c})
+	}
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func currentICESession(w http.ResponseWriter) *iceSession {
+	iceMu.Lock()
+	defer iceMu.Unlock()
+	if iceCurrent == nil {
+		writeError(w, 409, "conflict", errors.New("no ICE session, call /ice/offer or /ice/answer first"))
+	}
+	return iceCurrent
+}
+
+func handleICEDescription(controlling bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config, err := agentConfig(r)
+		if err != nil {
+			writeError(w, 400, "bad-request", err)
+			return
+		}
+		trickle := r.FormValue("trickle") == "true"
+		created := time.Now()
+		agent, err := ice.NewAgent(config)
+		if err != nil {
+			writeError(w, 500, "internal", err)
+			return
+		}
+		candidates := []ice.Candidate{}
+		if !trickle {
+			candidates, err = gather(agent)
+			if err != nil {
+				agent.Close()
+				writeError(w, 500, "internal", err)
+				return
+			}
+		}
+
+		session := &iceSession{agent: agent, controlling: controlling, created: created, state: "new", changed: make(chan struct{})}
+		agent.OnConnectionStateChange(func(state ice.ConnectionState) {
+			session.mu.Lock()
+			defer session.mu.Unlock()
+			session.state = strings.ToLower(state.String())
+			if state == ice.ConnectionStateConnected && session.connectedAfter == 0 {
+				session.connectedAfter = time.Since(session.created)
+			}
+		})
+		agent.OnSelectedCandidatePairChange(func(local, remote ice.Candidate) {
+			session.mu.Lock()
+			defer session.mu.Unlock()
+			session.local, session.remotePair = newICECandidate(local), newICECandidate(remote)
+		})
+		iceMu.Lock()
+		if iceCurrent != nil {
+			iceCurrent.agent.Close()
+		}
+		iceCurrent = session
+		iceMu.Unlock()
+
+		if trickle {
+			agent.OnCandidate(func(c ice.Candidate) {
+				if c == nil {
+					session.addCandidate(nil)
+				} else {
+					session.addCandidate(newICECandidate(c))
+				}
+			})
+			if err := agent.GatherCandidates(); err != nil {
+				writeError(w, 500, "internal", err)
+				return
+			}
+		}
+
+		ufrag, pwd, err := agent.GetLocalUserCredentials()
+		if err != nil {
+			writeError(w, 500, "internal", err)
+			return
+		}
+		description := protocol.ICEDescription{Ufrag: ufrag, Pwd: pwd, Candidates: make([]*protocol.Candidate, len(candidates))}
+		for i, candidate := range candidates {
+			description.Candidates[i] = newICECandidate(candidate)
+		}
+		json.NewEncoder(w).Encode(description)
+	}
+}
+
+func handleICERemote(w http.ResponseWriter, r *http.Request) {
+	var remote protocol.ICEDescription
+	if err := json.NewDecoder(r.Body).Decode(&remote); err != nil {
+		writeError(w, 400, "bad-request", err)
+		return
+	}
+	session := currentICESession(w)
+	if session == nil {
+		return
+	}
+	for _, c := range remote.Candidates {
+		candidate, err := toICE(c)
+		if err != nil {
+			writeError(w, 400, "bad-request", err)
+			return
+		}
+		if err := session.agent.AddRemoteCandidate(candidate); err != nil {
+			writeError(w, 500, "internal", err)
+			return
+		}
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.remote = &remote
+	json.NewEncoder(w).Encode(map[string]interface{}{})
+}
+
+func handleICEStart(w http.ResponseWriter, r *http.Request) {
+	session := currentICESession(w)
+	if session == nil {
+		return
+	}
+	timeout := 30 * time.Second
+	if raw := r.FormValue("timeout_seconds"); raw != "" {
+		seconds, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			writeError(w, 400, "bad-request", err)
+			return
+		}
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.remote == nil {
+		writeError(w, 409, "conflict", errors.New("no remote description, call /ice/remote first"))
+		return
+	}
+	if session.started {
+		writeError(w, 409, "conflict", errors.New("connectivity checks already started"))
+		return
+	}
+	session.started = true
+	session.state = "checking"
+	go func(ufrag, pwd string) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		var err error
+		if session.controlling {
+			_, err = session.agent.Dial(ctx, ufrag, pwd)
+		} else {
+			_, err = session.agent.Accept(ctx, ufrag, pwd)
+		}
+		if err != nil {
+			session.mu.Lock()
+			defer session.mu.Unlock()
+			session.state = "failed"
+			session.err = err.Error()
+		}
+	}(session.remote.Ufrag, session.remote.Pwd)
+	json.NewEncoder(w).Encode(map[string]interface{}{})
+}
+
+func handleICEState(w http.ResponseWriter, r *http.Request) {
+	session := currentICESession(w)
+	if session == nil {
+		return
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	json.NewEncoder(w).Encode(protocol.ICEState{
+		State:          session.state,
+		Local:          session.local,
+		Remote:         session.remotePair,
+		Error:          session.err,
+		ConnectedAfter: session.connectedAfter.Seconds(),
+	})
+}
+
+func handleICECandidates(w http.ResponseWriter, r *http.Request) {
+	session := currentICESession(w)
+	if session == nil {
+		return
+	}
+	after, _ := strconv.Atoi(r.FormValue("after"))
+	wait, _ := strconv.ParseFloat(r.FormValue("wait_seconds"), 64)
+	timeout := time.After(time.Duration(wait * float64(time.Second)))
+	for {
+		session.mu.Lock()
+		candidates := []*protocol.ICECandidateEvent{}
+		for _, event := range session.candidates {
+			if event.Index > after {
+				candidates = append(candidates, event)
+			}
+		}
+		gathered, changed := session.gathered, session.changed
+		session.mu.Unlock()
+		if len(candidates) > 0 || gathered {
+			json.NewEncoder(w).Encode(protocol.ICECandidatesResponse{Candidates: candidates, Done: gathered})
+			return
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			json.NewEncoder(w).Encode(protocol.ICECandidatesResponse{Candidates: candidates})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func handleICERemoteCandidates(w http.ResponseWriter, r *http.Request) {
+	var remote protocol.ICERemoteCandidates
+	if err := json.NewDecoder(r.Body).Decode(&remote); err != nil {
+		writeError(w, 400, "bad-request", err)
+		return
+	}
+	session := currentICESession(w)
+	if session == nil {
+		return
+	}
+	for _, c := range remote.Candidates {
+		candidate, err := toICE(c)
+		if err != nil {
+			writeError(w, 400, "bad-request", err)
+			return
+		}
+		if err := session.agent.AddRemoteCandidate(candidate); err != nil {
+			writeError(w, 500, "internal", err)
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{})
+}
@@ -2,47 +2,164 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"time"
 
-	"github.com/pion/ice"
+	"github.com/pion/ice/v2"
 	"github.com/pion/stun"
+	protocol "github.com/seppo0010/vortices/agent"
 	"github.com/sparrc/go-ping"
 )
 
+func writeError(w http.ResponseWriter, status int, code string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"code": code, "message": err.Error()},
+	})
+}
+
+// tcpMux accepts the ICE-TCP connections of every agent on a single port,
+// the one of their passive candidates.
+var tcpMux ice.TCPMux
+
+// agentConfig builds the ICE agent the runner asked for: the STUN and TURN
+// servers to gather from, whether to gather TCP and mDNS candidates, and the
+// addresses of the interfaces to ignore, such as the management network's.
+func agentConfig(r *http.Request) (*ice.AgentConfig, error) {
+	urls, err := iceURLs(r)
+	if err != nil {
+		return nil, err
+	}
+	ignored := map[string]bool{}
+	for _, address := range r.Form["ignore_address"] {
+		ignored[address] = true
+	}
+	config := &ice.AgentConfig{
+		Urls:             urls,
+		NetworkTypes:     []ice.NetworkType{ice.NetworkTypeUDP4},
+		MulticastDNSMode: mDNSMode(r),
+		IPFilter: func(ip net.IP) bool {
+			return !ignored[ip.String()]
+		},
+	}
+	if r.FormValue("tcp") == "true" {
+		config.NetworkTypes = append(config.NetworkTypes, ice.NetworkTypeTCP4)
+		config.TCPMux = tcpMux
+	}
+	return config, nil
+}
+
+// gather collects the local candidates of an agent that is not trickling.
+func gather(agent *ice.Agent) ([]ice.Candidate, error) {
+	gathered := make(chan struct{})
+	err := agent.OnCandidate(func(c ice.Candidate) {
+		if c == nil {
+			close(gathered)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = agent.GatherCandidates()
+	if err != nil {
+		return nil, err
+	}
+	<-gathered
+	return agent.GetLocalCandidates()
+}
+
+// iceURLs are the STUN and TURN servers the runner asked to gather from.
+func iceURLs(r *http.Request) ([]*stun.URI, error) {
+	r.ParseForm()
+	urls := []*stun.URI{}
+	for _, raw := range r.Form["stun"] {
+		u, err := stun.ParseURI(raw)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	usernames, passwords := r.Form["turn_username"], r.Form["turn_password"]
+	for i, raw := range r.Form["turn"] {
+		u, err := stun.ParseURI(raw)
+		if err != nil {
+			return nil, err
+		}
+		if i >= len(usernames) || i >= len(passwords) {
+			return nil, fmt.Errorf("missing credentials for %s", raw)
+		}
+		u.Username, u.Password = usernames[i], passwords[i]
+		urls = append(urls, u)
+	}
+	return urls, nil
+}
+
+// mDNSMode hides host candidates behind .local names when the runner asks
+// for it.
+func mDNSMode(r *http.Request) ice.MulticastDNSMode {
+	if r.FormValue("mdns") == "true" {
+		return ice.MulticastDNSModeQueryAndGather
+	}
+	return ice.MulticastDNSModeQueryOnly
+}
+
 func main() {
+	listener, err := net.ListenTCP("tcp4", &net.TCPAddr{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	tcpMux = ice.NewTCPMuxDefault(ice.TCPMuxParams{Listener: listener, ReadBufferSize: 8})
+
+	http.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(protocol.Version{
+			Protocol:       protocol.ProtocolVersion,
+			Implementation: "pion",
+			Capabilities: []string{
+				protocol.CapabilityGatherCandidates,
+				protocol.CapabilityPing,
+				protocol.CapabilityGetIPFromSTUN,
+				protocol.CapabilityICE,
+				protocol.CapabilityTrickleICE,
+				protocol.CapabilityICETCP,
+				protocol.CapabilityMDNS,
+			},
+		})
+	})
+	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(protocol.Health{Status: "ok"})
+	})
 	http.HandleFunc("/gather-candidates", func(w http.ResponseWriter, r *http.Request) {
-		agent, err := ice.NewAgent(&ice.AgentConfig{NetworkTypes: []ice.NetworkType{
-			ice.NetworkTypeUDP4,
-			ice.NetworkTypeUDP6,
-		}})
+		config, err := agentConfig(r)
+		if err != nil {
+			writeError(w, 400, "bad-request", err)
+			return
+		}
+		config.NetworkTypes = append(config.NetworkTypes, ice.NetworkTypeUDP6)
+		agent, err := ice.NewAgent(config)
 		if err != nil {
-			w.WriteHeader(500)
-			w.Write([]byte(err.Error()))
+			writeError(w, 500, "internal", err)
 			return
 		}
-		candidates, err := agent.GetLocalCandidates()
+		defer agent.Close()
+		candidates, err := gather(agent)
 		if err != nil {
-			w.WriteHeader(500)
-			w.Write([]byte(err.Error()))
+			writeError(w, 500, "internal", err)
 			return
 		}
-		candidatesMap := make([]interface{}, len(candidates))
+		described := make([]*protocol.Candidate, len(candidates))
 		for i, candidate := range candidates {
-			c := map[string]interface{}{}
-			c["address"] = candidate.Address()
-			candidatesMap[i] = c
+			described[i] = newICECandidate(candidate)
 		}
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"candidates": candidatesMap,
-		})
+		json.NewEncoder(w).Encode(protocol.GatherCandidatesResponse{Candidates: described})
 	})
 	http.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
 		pinger, err := ping.NewPinger(r.FormValue("ip"))
 		if err != nil {
-			w.WriteHeader(500)
-			w.Write([]byte(err.Error()))
+			writeError(w, 400, "bad-request", err)
 			return
 		}
 		pinger.Timeout = time.Second * 5
@@ -51,16 +168,17 @@ func main() {
 		pinger.Run()
 		stats := pinger.Statistics()
 
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"times": stats.Rtts,
-		})
+		times := make([]float64, len(stats.Rtts))
+		for i, rtt := range stats.Rtts {
+			times[i] = rtt.Seconds()
+		}
+		json.NewEncoder(w).Encode(protocol.PingResponse{Times: times})
 	})
 	http.HandleFunc("/get-ip-from-stun", func(w http.ResponseWriter, r *http.Request) {
 		// Creating a "connection" to STUN server.
 		c, err := stun.Dial("udp", r.FormValue("stun"))
 		if err != nil {
-			w.WriteHeader(500)
-			w.Write([]byte(err.Error()))
+			writeError(w, 500, "internal", err)
 			return
 		}
 		// Building binding request with random transaction id.
@@ -68,26 +186,28 @@ func main() {
 		// Sending request to STUN server, waiting for response message.
 		if err := c.Do(message, func(res stun.Event) {
 			if res.Error != nil {
-				w.WriteHeader(500)
-				w.Write([]byte(res.Error.Error()))
+				writeError(w, 500, "internal", res.Error)
 				return
 			}
 			// Decoding XOR-MAPPED-ADDRESS attribute from message.
 			var xorAddr stun.XORMappedAddress
 			if err := xorAddr.GetFrom(res.Message); err != nil {
-				w.WriteHeader(500)
-				w.Write([]byte(err.Error()))
+				writeError(w, 500, "internal", err)
 				return
 			}
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"ip": xorAddr.IP,
-			})
+			json.NewEncoder(w).Encode(protocol.GetIPFromSTUNResponse{IP: xorAddr.IP.String()})
 		}); err != nil {
-			w.WriteHeader(500)
-			w.Write([]byte(err.Error()))
+			writeError(w, 500, "internal", err)
 			return
 		}
 	})
+	http.HandleFunc("/ice/offer", handleICEDescription(true))
+	http.HandleFunc("/ice/answer", handleICEDescription(false))
+	http.HandleFunc("/ice/remote", handleICERemote)
+	http.HandleFunc("/ice/start", handleICEStart)
+	http.HandleFunc("/ice/state", handleICEState)
+	http.HandleFunc("/ice/candidates", handleICECandidates)
+	http.HandleFunc("/ice/remote-candidates", handleICERemoteCandidates)
 
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/seppo0010/vortices/agent"
+	dc "github.com/seppo0010/vortices/dockercompose"
+)
+
+// probeVersion starts the agent image on its own and asks for its version. A
+// nil version means the agent predates /version and is assumed to support
+// every capability.
+func probeVersion(image, transport string, timeout time.Duration) (*agent.Version, error) {
+	setup := dc.NewSetup()
+	network := setup.NewNetwork("network")
+	computer := setup.NewComputer("agent", image, nil, []*dc.Network{network})
+	err := setup.Start()
+	if err != nil {
+		return nil, err
+	}
+	defer setup.Stop()
+	client, err := newAgentClient(computer, transport)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for {
+		version, err := client.Version(ctx)
+		if e, ok := err.(*agent.Error); ok && e.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		if err == nil {
+			if version.Protocol != agent.ProtocolVersion {
+				return nil, fmt.Errorf("agent speaks protocol version %d, expected %d", version.Protocol, agent.ProtocolVersion)
+			}
+			return version, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("agent did not answer %s: %s", agent.PathVersion, err.Error())
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+func unsupportedCapabilities(t *Test, peers []implementation) []string {
+	unsupported := []string{}
+	seen := map[string]bool{}
+	for _, impl := range peers {
+		if seen[impl.Name] || impl.Version == nil {
+			continue
+		}
+		seen[impl.Name] = true
+		for _, capability := range t.Requires {
+			if !impl.Version.Supports(capability) {
+				unsupported = append(unsupported, fmt.Sprintf("%s does not support %s", impl.Name, capability))
+			}
+		}
+	}
+	return unsupported
+}
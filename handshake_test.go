@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/seppo0010/vortices/agent"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnsupportedCapabilities(t *testing.T) {
+	pion := implementation{Name: "pion", Version: &agent.Version{Protocol: agent.ProtocolVersion, Capabilities: []string{capabilityPing, capabilityICE}}}
+	minimal := implementation{Name: "minimal", Version: &agent.Version{Protocol: agent.ProtocolVersion, Capabilities: []string{capabilityPing}}}
+	legacy := implementation{Name: "legacy"}
+
+	test := &Test{Name: "nat-matrix", Requires: []string{capabilityICE}}
+	assert.Empty(t, unsupportedCapabilities(test, []implementation{pion, pion}))
+	assert.Empty(t, unsupportedCapabilities(test, []implementation{pion, legacy}))
+	assert.Equal(t, []string{"minimal does not support ice"}, unsupportedCapabilities(test, []implementation{minimal, minimal}))
+	assert.Equal(t, []string{"minimal does not support ice"}, unsupportedCapabilities(test, []implementation{pion, minimal}))
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	svgNodeWidth   = 140
+	svgNodeSpacing = 160
+	svgNodeHeight  = 40
+	svgNetworkTop  = 90
+	svgNetworkGap  = 36
+)
+
+func topologySVG(t *topology) template.HTML {
+	width := svgNodeSpacing*len(t.Nodes) + 40
+	if width < 300 {
+		width = 300
+	}
+	height := svgNetworkTop + svgNetworkGap*len(t.Networks)
+	networkY := map[string]int{}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" class="topology">`, width, height)
+	for i, network := range t.Networks {
+		y := svgNetworkTop + svgNetworkGap*i + svgNetworkGap/2
+		networkY[network] = y
+		fmt.Fprintf(&b, `<line x1="10" y1="%d" x2="%d" y2="%d" class="network"/>`, y, width-10, y)
+		fmt.Fprintf(&b, `<text x="12" y="%d" class="network-label">%s</text>`, y-4, template.HTMLEscapeString(network))
+	}
+	for i, node := range t.Nodes {
+		x := 20 + svgNodeSpacing*i
+		cx := x + svgNodeWidth/2
+		for _, network := range node.Networks {
+			y, found := networkY[network]
+			if !found {
+				continue
+			}
+			fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" class="link"/>`, cx, 10+svgNodeHeight, cx, y)
+			fmt.Fprintf(&b, `<circle cx="%d" cy="%d" r="4" class="link"/>`, cx, y)
+		}
+		fmt.Fprintf(&b, `<rect x="%d" y="10" width="%d" height="%d" rx="6" class="node %s"/>`, x, svgNodeWidth, svgNodeHeight, node.Kind)
+		fmt.Fprintf(&b, `<text x="%d" y="28" text-anchor="middle" class="node-label">%s</text>`, cx, template.HTMLEscapeString(node.Name))
+		detail := node.Kind
+		if node.Gateway != "" {
+			detail = "via " + node.Gateway
+		}
+		fmt.Fprintf(&b, `<text x="%d" y="43" text-anchor="middle" class="node-detail">%s</text>`, cx, template.HTMLEscapeString(detail))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+func rttSVG(p pingObservation) template.HTML {
+	const barWidth, chartHeight = 36, 100
+	width := barWidth*len(p.RTTs) + 20
+	if width < 120 {
+		width = 120
+	}
+	max := 0.0
+	for _, rtt := range p.RTTs {
+		if rtt > max {
+			max = rtt
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" class="rtt">`, width, chartHeight+20)
+	for i, rtt := range p.RTTs {
+		h := 1
+		if max > 0 {
+			h = int(rtt / max * (chartHeight - 15))
+		}
+		x := 10 + barWidth*i
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" class="bar"/>`, x+4, chartHeight-h, barWidth-8, h)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" class="bar-label">%.2f</text>`, x+barWidth/2, chartHeight-h-3, rtt)
+	}
+	fmt.Fprintf(&b, `<line x1="0" y1="%d" x2="%d" y2="%d" class="axis"/>`, chartHeight, width, chartHeight)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" class="bar-label">ms</text>`, width/2, chartHeight+15)
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+func fileURL(p string) template.URL {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		abs = p
+	}
+	return template.URL((&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String())
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"topologySVG": topologySVG,
+	"rttSVG":      rttSVG,
+	"fileURL":     fileURL,
+	"interop":     newInteropMatrices,
+	"natMatrix":   newNATMatrices,
+	"trickle": func(rows []trickleRow) []trickleRow {
+		rows = append([]trickleRow{}, rows...)
+		sortTrickleRows(rows)
+		return rows
+	},
+	"seconds": func(s float64) string {
+		return fmt.Sprintf("%.1fs", s)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>vortices report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 0.5em 0 1em; }
+th, td { border: 1px solid #ccc; padding: 0.25em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f3f3f3; }
+.status { font-weight: bold; text-transform: uppercase; }
+.passed { color: #1a7f37; }
+.failed { color: #cf222e; }
+.flaky { color: #9a6700; }
+.skipped { color: #777; }
+section { border-top: 1px solid #ddd; margin-top: 1.5em; }
+pre { background: #f6f8fa; padding: 0.5em; white-space: pre-wrap; }
+svg text { font-family: sans-serif; }
+.network { stroke: #0969da; stroke-width: 3; }
+.network-label { fill: #0969da; font-size: 11px; }
+.link { stroke: #555; fill: #555; }
+.node { fill: #ddf4ff; stroke: #0969da; }
+.node.router { fill: #fff8c5; stroke: #9a6700; }
+.node.stun { fill: #dafbe1; stroke: #1a7f37; }
+.node.signaling { fill: #fbefff; stroke: #8250df; }
+.node-label { font-size: 12px; font-weight: bold; }
+.node-detail { font-size: 10px; fill: #555; }
+.bar { fill: #0969da; }
+.bar-label { font-size: 10px; }
+.axis { stroke: #555; }
+</style>
+</head>
+<body>
+<h1>vortices report</h1>
+<p>{{.Image}} &middot; started {{.Started.Format "2006-01-02 15:04:05"}} &middot; {{seconds .Duration}}</p>
+<table>
+<tr><th>Test</th><th>Status</th><th>Attempts</th><th>Duration</th><th>Error</th></tr>
+{{range .Tests}}<tr>
+<td><a href="#{{.Name}}">{{.Name}}</a></td>
+<td class="status {{.Status}}">{{.Status}}</td>
+<td>{{.Attempts}}</td>
+<td>{{seconds .Duration}}</td>
+<td>{{.Error}}</td>
+</tr>
+{{end}}</table>
+{{range interop .Interop}}<h2>Interop behind {{.NAT}} NAT</h2>
+<table>
+<tr><th></th>{{range .Impls}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr><th>{{.Impl}}</th>{{range .Statuses}}<td class="status {{.}}">{{.}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}
+{{range natMatrix .NATMatrix}}<h2>NAT reachability ({{.Peers}})</h2>
+<p>Selected local/remote candidate types; - did not connect, ! differs from the expected matrix.</p>
+<table>
+<tr><th></th>{{range .Kinds}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr><th>{{.Kind}}</th>{{range .Cells}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}
+{{with .Trickle}}<h2>Trickle ICE</h2>
+<p>Milliseconds from the start of gathering; - never happened.</p>
+<table>
+<tr><th>Peers</th><th>NAT</th><th>Role</th><th>Candidates</th><th>First</th><th>Srflx</th><th>Relay</th><th>Connected</th></tr>
+{{range trickle .}}<tr><td>{{.Peers}}</td>{{range .Cells}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}
+{{range .Tests}}{{if ne .Status "skipped"}}
+<section id="{{.Name}}">
+<h2>{{.Name}} <span class="status {{.Status}}">{{.Status}}</span></h2>
+{{if .Error}}<pre>{{.Error}}</pre>{{end}}
+{{range .AttemptErrors}}<pre>attempt failed: {{.}}</pre>{{end}}
+{{range .Topologies}}<h3>Topology <small>{{.SetupID}}</small></h3>
+{{topologySVG .}}
+{{end}}
+{{with .Observations}}
+{{if .Candidates}}<h3>Candidates</h3>
+<table>
+<tr><th>Computer</th><th>Candidate</th><th>Priority</th><th>Foundation</th></tr>
+{{range .Candidates}}{{$computer := .Computer}}{{range .Candidates}}<tr><td>{{$computer}}</td><td>{{.String}}</td><td>{{if .Priority}}{{.Priority}}{{end}}</td><td>{{.Foundation}}</td></tr>
+{{end}}{{end}}</table>
+{{end}}
+{{if .Pairs}}<h3>Selected candidate pairs</h3>
+<table>
+<tr><th>Computer</th><th>Local</th><th>Remote</th></tr>
+{{range .Pairs}}<tr><td>{{.Computer}}</td><td>{{.Local}}</td><td>{{.Remote}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Pings}}<h3>Ping round trip times</h3>
+{{range .Pings}}<p>{{.From}} &rarr; {{.To}}</p>
+{{rttSVG .}}
+{{end}}{{end}}
+{{end}}
+{{if .Metrics}}<h3>Metrics</h3>
+<table>
+{{range $name, $value := .Metrics}}<tr><th>{{$name}}</th><td>{{$value}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Artifacts}}<h3>Artifacts</h3>
+<ul>
+{{if .ArtifactDir}}<li><a href="{{fileURL .ArtifactDir}}">{{.ArtifactDir}}</a></li>{{end}}
+{{range .Artifacts}}{{if or (eq .Kind "pcap") (eq .Kind "logs")}}<li>{{.Kind}}: <a href="{{fileURL .Path}}">{{.Name}}</a></li>
+{{end}}{{end}}</ul>
+{{end}}
+</section>
+{{end}}{{end}}
+</body>
+</html>
+`))
+
+func (r *report) writeHTML(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return htmlReportTemplate.Execute(f, r)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/seppo0010/vortices/agent"
+	dc "github.com/seppo0010/vortices/dockercompose"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportHTML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vortices-report")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	r := testReport()
+	tc := r.Tests[0]
+	setup := dc.NewSetup()
+	lan := setup.NewNetwork("lan")
+	internet := setup.NewNetwork("internet")
+	router := setup.NewRouter("router", "router", []*dc.Network{lan, internet})
+	setup.NewComputer("computer", "image", router, []*dc.Network{lan})
+	tc.Topologies = append(tc.Topologies, newTopology(setup))
+	tc.Observations.Candidates = []candidateObservation{{Computer: "computer", Candidates: []*agent.Candidate{{Address: "10.0.0.2"}}}}
+	tc.Observations.Pings = []pingObservation{{From: "computer", To: "10.0.1.2", RTTs: []float64{0.5, 1.25, 0.75}}}
+	r.Trickle = []trickleRow{{trickleTimings: trickleTimings{NAT: "symmetric", Role: "offerer", Candidates: 2, FirstCandidate: ms(12), Srflx: ms(240.4)}, Peers: "pion,pion"}}
+	tc.Artifacts = []reportArtifact{{Kind: "pcap", Name: "router.pcap", Path: "/tmp/artifacts/pcap/0001-router.pcap"}}
+
+	assert.Nil(t, r.writeHTML(path.Join(dir, "report.html")))
+	data, err := ioutil.ReadFile(path.Join(dir, "report.html"))
+	if !assert.Nil(t, err) {
+		return
+	}
+	html := string(data)
+	assert.Contains(t, html, `class="topology"`)
+	assert.Contains(t, html, ">computer</text>")
+	assert.Contains(t, html, ">via router</text>")
+	assert.Contains(t, html, "10.0.0.2")
+	assert.Contains(t, html, ">1.25</text>")
+	assert.Contains(t, html, "<td>symmetric</td><td>offerer</td><td>2</td><td>12</td><td>240</td><td>-</td><td>-</td>")
+	assert.Contains(t, html, `href="file:///tmp/artifacts/pcap/0001-router.pcap"`)
+	for _, line := range strings.Split(html, "\n") {
+		if strings.Contains(line, "http") {
+			assert.Contains(t, line, `xmlns="http://www.w3.org/2000/svg"`, "external reference in %q", line)
+		}
+	}
+}
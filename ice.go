@@ -0,0 +1,103 @@
+package main
+
+import (
+	"time"
+
+	"github.com/seppo0010/vortices/agent"
+	dc "github.com/seppo0010/vortices/dockercompose"
+)
+
+const icePollInterval = 200 * time.Millisecond
+
+// iceServers points agents to every STUN and TURN server in the setup.
+func iceServers(setup *dc.Setup) (agent.GatherOptions, error) {
+	opts := agent.GatherOptions{}
+	for _, server := range setup.STUNServers {
+		url, err := server.URL()
+		if err != nil {
+			return opts, err
+		}
+		opts.STUN = append(opts.STUN, url)
+	}
+	for _, server := range setup.TURNServers {
+		url, err := server.URL()
+		if err != nil {
+			return opts, err
+		}
+		opts.TURN = append(opts.TURN, agent.TURNServer{URL: url, Username: server.Username, Password: server.Password})
+	}
+	return opts, nil
+}
+
+// connectICE relays the offer and answer between two agents, starts their
+// connectivity checks and waits until both finish or the timeout expires. The
+// returned states belong to the offerer and the answerer, in that order.
+func connectICE(offerer, answerer *Computer, opts agent.GatherOptions, timeout time.Duration) ([]*agent.ICEState, error) {
+	_, err := startICE(offerer, answerer, opts, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return waitICE([]*Computer{offerer, answerer}, timeout)
+}
+
+// startICE returns the offer and the answer, in that order.
+func startICE(offerer, answerer *Computer, opts agent.GatherOptions, timeout time.Duration) ([]*agent.ICEDescription, error) {
+	offer, err := offerer.ICEOffer(opts)
+	if err != nil {
+		return nil, err
+	}
+	answer, err := answerer.ICEAnswer(opts)
+	if err != nil {
+		return nil, err
+	}
+	err = answerer.ICESetRemote(offer)
+	if err != nil {
+		return nil, err
+	}
+	err = offerer.ICESetRemote(answer)
+	if err != nil {
+		return nil, err
+	}
+	for _, peer := range []*Computer{offerer, answerer} {
+		err = peer.ICEStart(timeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []*agent.ICEDescription{offer, answer}, nil
+}
+
+// waitICE polls the peers until their connectivity checks finish or the
+// timeout expires, and records the selected pairs.
+func waitICE(peers []*Computer, timeout time.Duration) ([]*agent.ICEState, error) {
+	var err error
+	states := make([]*agent.ICEState, len(peers))
+	deadline := time.Now().Add(timeout + 5*time.Second)
+	for {
+		done := true
+		for i, peer := range peers {
+			if states[i] != nil && states[i].Done() {
+				continue
+			}
+			states[i], err = peer.ICEState()
+			if err != nil {
+				return nil, err
+			}
+			done = done && states[i].Done()
+		}
+		if done || time.Now().After(deadline) {
+			break
+		}
+		select {
+		case <-peers[0].test.Done():
+			return nil, peers[0].test.Err()
+		case <-time.After(icePollInterval):
+		}
+	}
+	for i, peer := range peers {
+		if states[i].Local != nil && states[i].Remote != nil {
+			peer.test.RecordSelectedPair(peer.Name, states[i].Local.String(), states[i].Remote.String())
+		}
+	}
+	return states, nil
+}
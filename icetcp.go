@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/seppo0010/vortices/agent"
+	dc "github.com/seppo0010/vortices/dockercompose"
+)
+
+func init() {
+	registerTest(&Test{
+		Name:        "ice-tcp-fallback",
+		Description: "a computer behind a router dropping UDP connects with ICE-TCP to a computer on the internet",
+		Tags:        []string{tagNAT, tagTCP},
+		Requires:    []string{capabilityICE, capabilityICETCP},
+		Weight:      4,
+		Peers:       2,
+		NAT:         string(dc.NATUDPBlocked),
+		Run:         testICETCPFallback,
+	})
+}
+
+// checkTCPFallback checks that the peer behind the UDP blocking router
+// connected through one of its own TCP host or server reflexive candidates.
+func checkTCPFallback(states []*agent.ICEState) error {
+	for i, state := range states {
+		if !state.Connected() {
+			return fmt.Errorf("peer %d did not connect without UDP: state %s %s", i, state.State, state.Error)
+		}
+	}
+	local := states[0].Local
+	if local == nil {
+		return fmt.Errorf("no selected candidate pair reported")
+	}
+	for _, m := range []candidateMatch{
+		{Type: agent.CandidateTypeHost, Protocol: agent.ProtocolTCP},
+		{Type: agent.CandidateTypeSrflx, Protocol: agent.ProtocolTCP},
+	} {
+		if m.matches(local) {
+			return nil
+		}
+	}
+	return fmt.Errorf("expected a tcp host or srflx local candidate, selected %s", local)
+}
+
+func testICETCPFallback(t *testContext) (err error) {
+	setup := t.NewSetup()
+	network1 := setup.NewNetwork("network1")
+	internet := setup.NewNetwork("internet")
+	router := setup.NewNATRouter("myrouter", t.router, dc.NATUDPBlocked, []*dc.Network{network1, internet})
+	computers := []*Computer{
+		t.Computer(setup.NewComputer("computer", t.image, router, []*dc.Network{network1})),
+		t.Computer(setup.NewComputer("computer2", t.peerImage, nil, []*dc.Network{internet})),
+	}
+	setup.NewSTUNServer("stun-server", []*dc.Network{internet})
+	err = t.StartSetup(setup)
+	if err != nil {
+		return err
+	}
+	defer teardown(setup, &err)
+	servers, err := iceServers(setup)
+	if err != nil {
+		return err
+	}
+	servers.TCP = true
+	states, err := connectICE(computers[0], computers[1], servers, 20*time.Second)
+	if err != nil {
+		return err
+	}
+	return checkTCPFallback(states)
+}
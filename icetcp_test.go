@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/seppo0010/vortices/agent"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckTCPFallback(t *testing.T) {
+	connected := func(local *agent.Candidate) []*agent.ICEState {
+		return []*agent.ICEState{
+			{State: agent.ICEStateConnected, Local: local},
+			{State: agent.ICEStateConnected},
+		}
+	}
+	assert.Nil(t, checkTCPFallback(connected(&agent.Candidate{Type: "host", Protocol: "tcp", TCPType: "active", Address: "10.0.0.2", Port: 9})))
+	assert.Nil(t, checkTCPFallback(connected(&agent.Candidate{Type: "srflx", Protocol: "tcp", Address: "172.31.0.3", Port: 4000})))
+	assert.EqualError(t, checkTCPFallback(connected(&agent.Candidate{Type: "relay", Protocol: "udp", Address: "172.31.0.4", Port: 6000})),
+		"expected a tcp host or srflx local candidate, selected relay udp 172.31.0.4:6000")
+	assert.EqualError(t, checkTCPFallback([]*agent.ICEState{{State: agent.ICEStateFailed, Error: "timeout"}, {State: agent.ICEStateFailed}}),
+		"peer 0 did not connect without UDP: state failed timeout")
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/seppo0010/vortices/agent"
+)
+
+type implementation struct {
+	Name    string
+	Path    string
+	Image   string
+	Version *agent.Version
+}
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func implementationNames(paths []string) []string {
+	names := make([]string, len(paths))
+	seen := map[string]int{}
+	for i, p := range paths {
+		name := filepath.Base(filepath.Clean(p))
+		seen[name]++
+		if seen[name] > 1 {
+			name = fmt.Sprintf("%s-%d", name, seen[name])
+		}
+		names[i] = name
+	}
+	return names
+}
+
+type testJob struct {
+	test    *Test
+	name    string
+	peers   []implementation
+	interop bool
+}
+
+// expandTests creates a job for every test, and for peer to peer tests one
+// per ordered pair of implementations when more than one is being tested.
+func expandTests(t *Test, impls []implementation) []*testJob {
+	if t.Peers < 2 || len(impls) < 2 {
+		return []*testJob{{test: t, name: t.Name, peers: []implementation{impls[0], impls[0]}}}
+	}
+	jobs := []*testJob{}
+	for _, a := range impls {
+		for _, b := range impls {
+			jobs = append(jobs, &testJob{
+				test:    t,
+				name:    fmt.Sprintf("%s[%s,%s]", t.Name, a.Name, b.Name),
+				peers:   []implementation{a, b},
+				interop: true,
+			})
+		}
+	}
+	return jobs
+}
+
+type interopCell struct {
+	NAT    string `json:"nat"`
+	A      string `json:"a"`
+	B      string `json:"b"`
+	Test   string `json:"test"`
+	Status string `json:"status"`
+}
+
+func worstStatus(a, b string) string {
+	rank := map[string]int{"": 0, statusSkipped: 1, statusPassed: 2, statusFlaky: 3, statusFailed: 4}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+type interopMatrix struct {
+	NAT   string
+	Impls []string
+	Rows  []interopRow
+}
+
+type interopRow struct {
+	Impl     string
+	Statuses []string
+}
+
+func newInteropMatrices(cells []interopCell) []interopMatrix {
+	byNAT := map[string]map[string]map[string]string{}
+	implSet := map[string]bool{}
+	for _, cell := range cells {
+		if byNAT[cell.NAT] == nil {
+			byNAT[cell.NAT] = map[string]map[string]string{}
+		}
+		if byNAT[cell.NAT][cell.A] == nil {
+			byNAT[cell.NAT][cell.A] = map[string]string{}
+		}
+		byNAT[cell.NAT][cell.A][cell.B] = worstStatus(byNAT[cell.NAT][cell.A][cell.B], cell.Status)
+		implSet[cell.A] = true
+		implSet[cell.B] = true
+	}
+	impls := []string{}
+	for impl := range implSet {
+		impls = append(impls, impl)
+	}
+	sort.Strings(impls)
+	nats := []string{}
+	for nat := range byNAT {
+		nats = append(nats, nat)
+	}
+	sort.Strings(nats)
+
+	matrices := []interopMatrix{}
+	for _, nat := range nats {
+		m := interopMatrix{NAT: nat, Impls: impls}
+		for _, a := range impls {
+			row := interopRow{Impl: a}
+			for _, b := range impls {
+				status := byNAT[nat][a][b]
+				if status == "" {
+					status = "-"
+				}
+				row.Statuses = append(row.Statuses, status)
+			}
+			m.Rows = append(m.Rows, row)
+		}
+		matrices = append(matrices, m)
+	}
+	return matrices
+}
+
+func printInteropMatrix(w io.Writer, cells []interopCell) {
+	for _, m := range newInteropMatrices(cells) {
+		fmt.Fprintf(w, "\ninterop behind %s NAT (rows connect to columns)\n", m.NAT)
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "\t%s\n", strings.Join(m.Impls, "\t"))
+		for _, row := range m.Rows {
+			fmt.Fprintf(tw, "%s\t%s\n", row.Impl, strings.Join(row.Statuses, "\t"))
+		}
+		tw.Flush()
+	}
+}
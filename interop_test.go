@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandTests(t *testing.T) {
+	pion := implementation{Name: "pion", Image: "pion-image"}
+	other := implementation{Name: "other", Image: "other-image"}
+
+	jobs := expandTests(&Test{Name: "stun"}, []implementation{pion, other})
+	if assert.Equal(t, 1, len(jobs)) {
+		assert.Equal(t, "stun", jobs[0].name)
+		assert.Equal(t, []implementation{pion, pion}, jobs[0].peers)
+	}
+
+	jobs = expandTests(&Test{Name: "gateway", Peers: 2}, []implementation{pion})
+	if assert.Equal(t, 1, len(jobs)) {
+		assert.False(t, jobs[0].interop)
+	}
+
+	jobs = expandTests(&Test{Name: "gateway", Peers: 2}, []implementation{pion, other})
+	names := []string{}
+	for _, job := range jobs {
+		names = append(names, job.name)
+		assert.True(t, job.interop)
+	}
+	assert.Equal(t, []string{"gateway[pion,pion]", "gateway[pion,other]", "gateway[other,pion]", "gateway[other,other]"}, names)
+	assert.Equal(t, []implementation{other, pion}, jobs[2].peers)
+}
+
+func TestImplementationNames(t *testing.T) {
+	assert.Equal(t, []string{"pion", "libwebrtc", "pion-2"}, implementationNames([]string{"examples/pion", "../libwebrtc/", "other/pion"}))
+}
+
+func TestInteropMatrix(t *testing.T) {
+	var out bytes.Buffer
+	printInteropMatrix(&out, []interopCell{
+		{NAT: "symmetric", A: "pion", B: "pion", Status: statusPassed},
+		{NAT: "symmetric", A: "pion", B: "other", Status: statusFailed},
+		{NAT: "symmetric", A: "other", B: "pion", Status: statusPassed},
+		{NAT: "symmetric", A: "other", B: "pion", Status: statusFlaky},
+	})
+	assert.Equal(t, `
+interop behind symmetric NAT (rows connect to columns)
+       other   pion
+other  -       flaky
+pion   failed  passed
+`, out.String())
+}
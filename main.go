@@ -1,188 +1,222 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
-	"reflect"
+	"path/filepath"
 	"runtime"
-	"sort"
-	"sync"
+	"strings"
+	"time"
 
+	"github.com/seppo0010/vortices/agent"
 	dc "github.com/seppo0010/vortices/dockercompose"
 )
 
+var keepOnFailure bool
+
 func main() {
-	if len(os.Args) < 2 {
-		log.Fatalf("usage: %s <path to target>", os.Args[0])
+	rebuild := flag.Bool("rebuild", false, "build docker images even if an image with the same content exists")
+	grace := flag.Duration("grace", 30*time.Second, "time to wait for running setups to stop after an interrupt")
+	flag.BoolVar(&keepOnFailure, "keep-on-failure", os.Getenv("VORTICES_KEEP_ON_FAILURE") != "", "leave the containers of failed tests running (also VORTICES_KEEP_ON_FAILURE)")
+	run := flag.String("run", "", "only run tests whose name matches this regular expression")
+	parallel := flag.Int("parallel", runtime.NumCPU(), "maximum number of tests running at the same time")
+	maxContainers := flag.Int("max-containers", 4*runtime.NumCPU(), "maximum number of containers started by running tests; each test weighs its number of containers")
+	timeout := flag.Duration("timeout", 10*time.Minute, "time after which a test is cancelled and its setups torn down")
+	retries := flag.Int("retries", 0, "number of times a failing test is retried; tests passing after a retry are reported as flaky")
+	flakyLog := flag.String("flaky-log", "", "file to append a JSON line to for every flaky test")
+	jsonReport := flag.String("json", "", "write a JSON report of the run to this file")
+	junitReport := flag.String("junit", "", "write a JUnit XML report of the run to this file")
+	htmlReport := flag.String("html", "", "write a self-contained HTML report of the run to this file")
+	var peers stringList
+	flag.Var(&peers, "peer", "path to another agent implementation; peer to peer tests run for every ordered pair of implementations (can be repeated)")
+	natMatrix := flag.String("nat-matrix", "nat-matrix.txt", "expected NAT reachability matrix the nat-matrix tests are checked against")
+	transport := flag.String("transport", transportDirect, fmt.Sprintf("how the runner reaches agents: %s (container IP, needs a route to docker networks) or %s (curl through docker exec)", transportDirect, transportExec))
+	ready := flag.Duration("ready-timeout", time.Minute, "time to wait for the agents of a setup to report ready before failing the test")
+	handshakeTimeout := flag.Duration("handshake-timeout", time.Minute, "time to wait for an agent to answer its version before running tests")
+	signalingPath := flag.String("signaling", "signaling", "path to the signaling server, only built when a selected test is tagged signaling")
+	agentSource := flag.String("agent-source", "agent", "path to the agent package of vortices, the "+agentContext+" build context of agent images")
+	tags := flag.String("tags", "!slow", "only run tests whose tags match this expression, e.g. \"nat && !slow\"; empty runs every test")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <path to target> [test name globs...]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s list\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s down <setup id>...\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s gc [-ttl duration]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	switch flag.Arg(0) {
+	case "down":
+		if !down(flag.Args()[1:]) {
+			os.Exit(1)
+		}
+		return
+	case "gc":
+		if !gc(flag.Args()[1:]) {
+			os.Exit(1)
+		}
+		return
+	case "list":
+		listTests(os.Stdout, registeredTests)
+		return
 	}
-	router, err := dc.BuildDocker("router", `
-FROM ubuntu
-RUN apt update && apt install -y iptables tcpdump
-CMD ["sleep", "infinity"]
-    `)
+	selector, err := newTestSelector(flag.Args()[1:], *run, *tags)
 	if err != nil {
 		log.Fatalf("%s", err.Error())
 	}
-
-	image, err := dc.BuildDockerPath(os.Args[1], os.Args[1])
+	expectedNATMatrix, err = loadNATMatrix(*natMatrix)
+	if os.IsNotExist(err) {
+		log.Printf("expected NAT matrix %s not found, nat-matrix tests will only record outcomes", *natMatrix)
+	} else if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	handleSignals(*grace)
+	buildOptions := dc.BuildOptions{Force: *rebuild}
+	router, err := dc.BuildDockerWithOptions("router", `
+FROM ubuntu
+RUN apt update && apt install -y iproute2 iptables tcpdump
+CMD ["sleep", "infinity"]
+    `, buildOptions)
 	if err != nil {
 		log.Fatalf("%s", err.Error())
 	}
 
-	if !runTests(image, router, os.Args[2:]) {
-		os.Exit(1)
+	signaling := ""
+	if selector.selectsTag(registeredTests, tagSignaling) {
+		signaling, err = dc.BuildDockerPathWithOptions("signaling", *signalingPath, buildOptions)
+		if err != nil {
+			log.Fatalf("%s", err.Error())
+		}
 	}
-}
 
-func contains(s []string, e string) bool {
-	for _, a := range s {
-		if a == e {
-			return true
-		}
+	agentDir, err := agentSourceDir(*agentSource)
+	if err != nil {
+		log.Fatalf("%s", err.Error())
 	}
-	return false
-}
-func runTests(image, router string, tests []string) bool {
-	type result struct {
-		testName string
-		err      error
-		skipped  bool
-	}
-	type testRunner func(image, router string) error
-	allTests := []testRunner{testICECandidatesGather, testGateway, testStun}
-	resultChan := make(chan result, len(allTests))
-	var wg sync.WaitGroup
-	for _, tr := range allTests {
-		wg.Add(1)
-		go func(tr testRunner) {
-			testName := runtime.FuncForPC(reflect.ValueOf(tr).Pointer()).Name()
-			res := result{testName: testName}
-			log.Printf("running test %v", res.testName)
-			if len(tests) > 0 && !contains(tests, testName) {
-				log.Printf("skipped test %v", res.testName)
-				res.skipped = true
-			} else {
-				res.err = tr(image, router)
-				if res.err == nil {
-					log.Printf("finished OK test %v", res.testName)
-				} else {
-					log.Printf("test %v failed: %s", res.testName, res.err.Error())
-				}
-			}
-			resultChan <- res
-			wg.Done()
-		}(tr)
-	}
-	wg.Wait()
-	close(resultChan)
-	for res := range resultChan {
-		if !res.skipped && res.err != nil {
-			return false
+	agentOptions := buildOptions
+	agentOptions.Contexts = map[string]string{agentContext: agentDir}
+	paths := append([]string{flag.Arg(0)}, peers...)
+	impls := []implementation{}
+	for i, name := range implementationNames(paths) {
+		image, err := dc.BuildDockerPathWithOptions(name, paths[i], agentOptions)
+		if err != nil {
+			log.Fatalf("%s", err.Error())
 		}
-	}
-	return true
-}
-
-func checkCandidatesMatch(candidates []*Candidate, ipaddresses []string) error {
-	if len(candidates) != len(ipaddresses) {
-		return fmt.Errorf("expected %d candidates, got %d", len(ipaddresses), len(candidates))
-	}
-	addresses := make([]string, len(candidates))
-	for i, candidate := range candidates {
-		addresses[i] = candidate.Address
-	}
-	sort.Strings(addresses)
-	sort.Strings(ipaddresses)
-	for i, addr1 := range addresses {
-		if addr1 != ipaddresses[i] {
-			return fmt.Errorf("ip addresses do not match\ncontainer has: %#v\nreceived: %#v", ipaddresses, addresses)
+		version, err := probeVersion(image, *transport, *handshakeTimeout)
+		if err != nil {
+			log.Fatalf("%s: %s", name, err.Error())
 		}
+		if version == nil {
+			log.Printf("%s does not implement %s, assuming it supports every test", name, agent.PathVersion)
+		} else {
+			log.Printf("%s speaks agent protocol %d with capabilities %s", name, version.Protocol, strings.Join(version.Capabilities, ", "))
+		}
+		impls = append(impls, implementation{Name: name, Path: paths[i], Image: image, Version: version})
 	}
-	return nil
-}
 
-func testICECandidatesGather(image, router string) error {
-	setup := dc.NewSetup()
-	network1 := setup.NewNetwork("network1")
-	network2 := setup.NewNetwork("network2")
-	computers := []*dc.Computer{
-		setup.NewComputer("computer", image, nil, []*dc.Network{network1, network2}),
-		setup.NewComputer("computer2", image, nil, []*dc.Network{network1}),
-	}
-	err := setup.Start()
-	if err != nil {
-		return err
-	}
-	defer setup.Stop()
-	for _, computer := range computers {
-		candidates, err := (&Computer{computer}).GatherCandidates()
+	cfg := &runConfig{
+		impls:     impls,
+		router:    router,
+		signaling: signaling,
+		timeout:   *timeout,
+		retries:   *retries,
+		grace:     *grace,
+		flakyLog:  *flakyLog,
+		ready:     *ready,
+		transport: *transport,
+	}
+	started := time.Now()
+	results := runTests(cfg, selector, newScheduler(*parallel, *maxContainers))
+	r := newReport(started, flag.Arg(0), results)
+	r.printSummary(os.Stdout)
+	if *jsonReport != "" {
+		err = r.writeJSON(*jsonReport)
 		if err != nil {
-			return err
+			log.Printf("failed to write JSON report: %s", err.Error())
 		}
-		ips, err := computer.GetAllIPAddresses()
+	}
+	if *junitReport != "" {
+		err = r.writeJUnit(*junitReport)
 		if err != nil {
-			return err
+			log.Printf("failed to write JUnit report: %s", err.Error())
 		}
-		err = checkCandidatesMatch(candidates, ips)
+	}
+	if *htmlReport != "" {
+		err = r.writeHTML(*htmlReport)
 		if err != nil {
-			return err
+			log.Printf("failed to write HTML report: %s", err.Error())
 		}
 	}
-	return nil
+	if !r.ok() {
+		os.Exit(1)
+	}
 }
 
-func testGateway(image, router string) error {
-	setup := dc.NewSetup()
-	network1 := setup.NewNetwork("network1")
-	internet := setup.NewNetwork("internet")
-	gateway := setup.NewRouter("myrouter", router, []*dc.Network{network1, internet})
-	computers := []*dc.Computer{
-		setup.NewComputer("computer", image, gateway, []*dc.Network{network1}),
-		setup.NewComputer("computer2", image, nil, []*dc.Network{internet}),
-	}
-	err := setup.Start()
-	if err != nil {
-		return err
-	}
-	defer setup.Stop()
-	ips, err := computers[1].GetAllIPAddresses()
+// agentContext is the build context agents written in Go can copy the agent
+// package from, as examples/pion does.
+const agentContext = "vortices-agent"
+
+// agentSourceDir resolves the directory of the agent package, failing with a
+// hint at -agent-source rather than letting agent builds fail on a missing
+// build context.
+func agentSourceDir(path string) (string, error) {
+	dir, err := filepath.Abs(path)
 	if err != nil {
-		return err
+		return "", err
 	}
-	_, err = (&Computer{computers[0]}).Ping(ips[0])
-	if err != nil {
-		return err
+	info, err := os.Stat(filepath.Join(dir, "protocol.go"))
+	if err != nil || info.IsDir() {
+		return "", fmt.Errorf("agent package not found in %s, pass -agent-source with the path to the agent directory of vortices", dir)
 	}
-	return nil
+	return dir, nil
 }
 
-func testStun(image, router string) error {
-	setup := dc.NewSetup()
-	network1 := setup.NewNetwork("network1")
-	internet := setup.NewNetwork("internet")
-	routerComputer := setup.NewRouter("myrouter", router, []*dc.Network{network1, internet})
-	computer := setup.NewComputer("computer", image, routerComputer, []*dc.Network{network1})
-	stun := setup.NewSTUNServer("stun-server", []*dc.Network{internet})
-	err := setup.Start()
-	if err != nil {
-		return err
-	}
-	defer setup.Stop()
-	ips, err := stun.GetAllIPAddresses()
-	if err != nil {
-		return err
+func down(ids []string) bool {
+	if len(ids) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	ok := true
+	for _, id := range ids {
+		err := dc.Down(id)
+		if err != nil {
+			log.Printf("failed to tear down setup %s: %s", id, err.Error())
+			ok = false
+		}
 	}
-	stunIP, err := (&Computer{computer}).GetIPFromSTUN(ips[0] + ":3478")
-	if err != nil {
-		return err
+	return ok
+}
+
+func gc(args []string) bool {
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	ttl := flags.Duration("ttl", time.Hour, "remove setups created longer than this ago")
+	flags.Parse(args)
+	removed, err := dc.RemoveStaleSetups(*ttl)
+	for _, id := range removed {
+		log.Printf("removed setup %s", id)
 	}
-	routerIP, err := routerComputer.GetIPAddressForNetwork(internet)
 	if err != nil {
-		return err
-	}
-	if stunIP != routerIP {
-		return fmt.Errorf("expected stun ip (%s) to match router ip (%s)", stunIP, routerIP)
+		log.Printf("failed to remove stale setups: %s", err.Error())
+		return false
 	}
-	return nil
+	return true
+}
+
+func teardown(setup *dc.Setup, err *error) {
+	if *err == nil || !keepOnFailure {
+		setup.Stop()
+		return
+	}
+	setup.Keep()
+	msg := fmt.Sprintf("keeping setup %s running after failure\n  artifacts: %s\n", setup.ID, setup.ArtifactDir)
+	for _, name := range setup.ContainerNames() {
+		msg += fmt.Sprintf("  docker exec -it %s sh\n", name)
+	}
+	msg += fmt.Sprintf("  tear it down with: %s down %s", os.Args[0], setup.ID)
+	log.Print(msg)
 }
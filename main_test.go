@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgentSourceDir(t *testing.T) {
+	dir, err := agentSourceDir("agent")
+	assert.Nil(t, err)
+	wd, _ := os.Getwd()
+	assert.Equal(t, filepath.Join(wd, "agent"), dir)
+
+	_, err = agentSourceDir("dockercompose")
+	assert.EqualError(t, err, "agent package not found in "+filepath.Join(wd, "dockercompose")+", pass -agent-source with the path to the agent directory of vortices")
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/seppo0010/vortices/agent"
+	dc "github.com/seppo0010/vortices/dockercompose"
+)
+
+func init() {
+	registerTest(&Test{
+		Name:        "mdns-lan",
+		Description: "two computers in the same network connect through mDNS host candidates that hide their addresses",
+		Tags:        []string{tagMDNS},
+		Requires:    []string{capabilityICE, capabilityMDNS},
+		Weight:      3,
+		Peers:       2,
+		Run:         testMDNSLAN,
+	})
+	registerTest(&Test{
+		Name:        "mdns-router",
+		Description: "mDNS queries for the names of a computer behind a router and a computer on the internet stay on their side of the router",
+		Tags:        []string{tagNAT, tagMDNS},
+		Requires:    []string{capabilityICE, capabilityMDNS},
+		Weight:      4,
+		Peers:       2,
+		Run:         testMDNSRouter,
+	})
+}
+
+// checkMDNSCandidates checks that every peer sent host candidates and that
+// none of its candidates reveal one of its addresses.
+func checkMDNSCandidates(descriptions []*agent.ICEDescription, addresses [][]string) error {
+	for i, description := range descriptions {
+		hidden := map[string]bool{}
+		for _, address := range addresses[i] {
+			hidden[address] = true
+		}
+		hosts := 0
+		for _, candidate := range description.Candidates {
+			if hidden[candidate.Address] || hidden[candidate.RelatedAddress] {
+				return fmt.Errorf("peer %d revealed its address in %s", i, candidate)
+			}
+			if !candidate.IsHost() {
+				continue
+			}
+			if !candidate.IsMDNS() {
+				return fmt.Errorf("peer %d sent a host candidate without an mDNS name: %s", i, candidate)
+			}
+			hosts++
+		}
+		if hosts == 0 {
+			return fmt.Errorf("peer %d sent no host candidates", i)
+		}
+	}
+	return nil
+}
+
+// mDNSNames are the names hiding the host candidates of a description.
+func mDNSNames(description *agent.ICEDescription) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, candidate := range description.Candidates {
+		if candidate.IsHost() && candidate.IsMDNS() && !seen[candidate.Address] {
+			seen[candidate.Address] = true
+			names = append(names, candidate.Address)
+		}
+	}
+	return names
+}
+
+func mentions(packets []string, name string) bool {
+	for _, packet := range packets {
+		if strings.Contains(packet, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMDNSContained checks the mDNS packets captured on both sides of the
+// router: each peer must have queried the other's names on its own side, and
+// none of those queries may show up on the other side.
+func checkMDNSContained(lanNames, internetNames, lanPackets, internetPackets []string) error {
+	for _, side := range []struct {
+		name, other     string
+		queried         []string
+		packets, leaked []string
+	}{
+		{"lan", "internet", internetNames, lanPackets, internetPackets},
+		{"internet", "lan", lanNames, internetPackets, lanPackets},
+	} {
+		for _, name := range side.queried {
+			if !mentions(side.packets, name) {
+				return fmt.Errorf("no query for %s on the %s side, mDNS is not working", name, side.name)
+			}
+			if mentions(side.leaked, name) {
+				return fmt.Errorf("query for %s from the %s side leaked to the %s side", name, side.name, side.other)
+			}
+		}
+	}
+	return nil
+}
+
+// checkMDNSOffManagement checks that no query for names crossed the
+// management network, which every computer of the setup is in.
+func checkMDNSOffManagement(names, managementPackets []string) error {
+	for _, name := range names {
+		if mentions(managementPackets, name) {
+			return fmt.Errorf("query for %s leaked to the management network", name)
+		}
+	}
+	return nil
+}
+
+// hiddenAddresses are every address of the computer, including its
+// management network's, which agents cannot tell apart under mDNS names.
+func hiddenAddresses(computer *Computer) ([]string, error) {
+	addresses, err := computer.GetAllIPAddresses()
+	if err != nil {
+		return nil, err
+	}
+	if computer.Management == nil {
+		return addresses, nil
+	}
+	management, err := computer.GetManagementIPAddress()
+	if err != nil {
+		return nil, err
+	}
+	return append(addresses, management), nil
+}
+
+// checkManagementCapture checks that the mDNS names of no description were
+// queried in the capture of the management network.
+func checkManagementCapture(capture *dc.Capture, descriptions []*agent.ICEDescription) error {
+	packets, err := capture.Packets()
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for _, description := range descriptions {
+		names = append(names, mDNSNames(description)...)
+	}
+	return checkMDNSOffManagement(names, packets)
+}
+
+func startMDNS(t *testContext, computers []*Computer, opts agent.GatherOptions, timeout time.Duration) ([]*agent.ICEDescription, []*agent.ICEState, error) {
+	opts.MDNS = true
+	descriptions, err := startICE(computers[0], computers[1], opts, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	addresses := make([][]string, len(computers))
+	for i, computer := range computers {
+		t.RecordCandidates(computer.Name, descriptions[i].Candidates)
+		addresses[i], err = hiddenAddresses(computer)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	err = checkMDNSCandidates(descriptions, addresses)
+	if err != nil {
+		return nil, nil, err
+	}
+	states, err := waitICE(computers, timeout)
+	return descriptions, states, err
+}
+
+func testMDNSLAN(t *testContext) (err error) {
+	setup := t.NewSetup()
+	lan := setup.NewNetwork("lan")
+	lan.Multicast = true
+	computers := []*Computer{
+		t.Computer(setup.NewComputer("computer", t.image, nil, []*dc.Network{lan})),
+		t.Computer(setup.NewComputer("computer2", t.peerImage, nil, []*dc.Network{lan})),
+	}
+	sniffer := setup.NewSniffer("management-sniffer", t.router, setup.Management)
+	err = t.StartSetup(setup)
+	if err != nil {
+		return err
+	}
+	defer teardown(setup, &err)
+	managementCapture, err := sniffer.Capture("udp port 5353")
+	if err != nil {
+		return err
+	}
+	descriptions, states, err := startMDNS(t, computers, agent.GatherOptions{}, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	err = checkManagementCapture(managementCapture, descriptions)
+	if err != nil {
+		return err
+	}
+	for i, state := range states {
+		if !state.Connected() {
+			return fmt.Errorf("peer %d did not connect through mDNS candidates: state %s %s", i, state.State, state.Error)
+		}
+	}
+	return nil
+}
+
+func testMDNSRouter(t *testContext) (err error) {
+	setup := t.NewSetup()
+	lan := setup.NewNetwork("lan")
+	lan.Multicast = true
+	internet := setup.NewNetwork("internet")
+	internet.Multicast = true
+	router := setup.NewRouter("myrouter", t.router, []*dc.Network{lan, internet})
+	computers := []*Computer{
+		t.Computer(setup.NewComputer("computer", t.image, router, []*dc.Network{lan})),
+		t.Computer(setup.NewComputer("computer2", t.peerImage, nil, []*dc.Network{internet})),
+	}
+	sniffer := setup.NewSniffer("management-sniffer", t.router, setup.Management)
+	err = t.StartSetup(setup)
+	if err != nil {
+		return err
+	}
+	defer teardown(setup, &err)
+	lanCapture, err := router.Capture(lan, "udp port 5353")
+	if err != nil {
+		return err
+	}
+	internetCapture, err := router.Capture(internet, "udp port 5353")
+	if err != nil {
+		return err
+	}
+	managementCapture, err := sniffer.Capture("udp port 5353")
+	if err != nil {
+		return err
+	}
+	descriptions, _, err := startMDNS(t, computers, agent.GatherOptions{}, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	lanPackets, err := lanCapture.Packets()
+	if err != nil {
+		return err
+	}
+	internetPackets, err := internetCapture.Packets()
+	if err != nil {
+		return err
+	}
+	err = checkManagementCapture(managementCapture, descriptions)
+	if err != nil {
+		return err
+	}
+	return checkMDNSContained(mDNSNames(descriptions[0]), mDNSNames(descriptions[1]), lanPackets, internetPackets)
+}
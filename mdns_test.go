@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/seppo0010/vortices/agent"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckMDNSCandidates(t *testing.T) {
+	describe := func(candidates ...*agent.Candidate) *agent.ICEDescription {
+		return &agent.ICEDescription{Candidates: candidates}
+	}
+	hidden := &agent.Candidate{Type: "host", Protocol: "udp", Address: "3c9f2b1e-7d4a-4e8f-a6b5-0c1d2e3f4a5b.local", Port: 5000}
+	addresses := [][]string{{"10.0.0.2"}, {"10.0.0.3"}}
+	assert.Nil(t, checkMDNSCandidates([]*agent.ICEDescription{describe(hidden), describe(hidden)}, addresses))
+	assert.EqualError(t, checkMDNSCandidates([]*agent.ICEDescription{describe(hidden), describe(&agent.Candidate{Type: "host", Protocol: "udp", Address: "10.0.0.3", Port: 5000})}, addresses),
+		"peer 1 revealed its address in host udp 10.0.0.3:5000")
+	assert.EqualError(t, checkMDNSCandidates([]*agent.ICEDescription{describe(&agent.Candidate{Type: "host", Protocol: "udp", Address: "172.18.0.2", Port: 5000}), describe(hidden)}, addresses),
+		"peer 0 sent a host candidate without an mDNS name: host udp 172.18.0.2:5000")
+	assert.EqualError(t, checkMDNSCandidates([]*agent.ICEDescription{describe(hidden), describe()}, addresses),
+		"peer 1 sent no host candidates")
+}
+
+func TestCheckMDNSContained(t *testing.T) {
+	lanName, internetName := "3c9f2b1e.local", "8a7d6c5b.local"
+	query := func(src, name string) string {
+		return "12:00:00.000000 IP " + src + ".5353 > 224.0.0.251.5353: 0 A (QM)? " + name + ". (35)"
+	}
+	lan := []string{query("10.0.0.2", internetName)}
+	internet := []string{query("172.31.0.3", lanName)}
+	assert.Nil(t, checkMDNSContained([]string{lanName}, []string{internetName}, lan, internet))
+	assert.EqualError(t, checkMDNSContained([]string{lanName}, []string{internetName}, nil, internet),
+		"no query for 8a7d6c5b.local on the lan side, mDNS is not working")
+	assert.EqualError(t, checkMDNSContained([]string{lanName}, []string{internetName}, lan, append(internet, query("172.31.0.2", internetName))),
+		"query for 8a7d6c5b.local from the lan side leaked to the internet side")
+	assert.EqualError(t, checkMDNSContained([]string{lanName}, []string{internetName}, append(lan, query("10.0.0.1", lanName)), internet),
+		"query for 3c9f2b1e.local from the internet side leaked to the lan side")
+}
+
+func TestMDNSNames(t *testing.T) {
+	assert.Equal(t, []string{"3c9f2b1e.local"}, mDNSNames(&agent.ICEDescription{Candidates: []*agent.Candidate{
+		{Type: "host", Protocol: "udp", Address: "3c9f2b1e.local", Port: 5000},
+		{Type: "host", Protocol: "udp", Address: "3c9f2b1e.local", Port: 5001},
+		{Type: "srflx", Protocol: "udp", Address: "172.31.0.3", Port: 4000},
+	}}))
+}
+
+func TestCheckMDNSOffManagement(t *testing.T) {
+	names := []string{"3c9f2b1e.local", "8a7d6c5b.local"}
+	other := "12:00:00.000000 IP 172.30.0.2.5353 > 224.0.0.251.5353: 0 A (QM)? 0f1e2d3c.local. (35)"
+	assert.Nil(t, checkMDNSOffManagement(names, []string{other}))
+	assert.EqualError(t, checkMDNSOffManagement(names, []string{other, "12:00:00.000000 IP 172.30.0.3.5353 > 224.0.0.251.5353: 0 A (QM)? 8a7d6c5b.local. (35)"}),
+		"query for 8a7d6c5b.local leaked to the management network")
+}
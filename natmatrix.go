@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	dc "github.com/seppo0010/vortices/dockercompose"
+)
+
+const (
+	natNone                 = "none"
+	natMatrixConnectTimeout = 20 * time.Second
+)
+
+var natMatrixKinds = []string{natNone}
+
+// expectedNATMatrix maps "a/b" to whether a peer behind a should be able to
+// connect to a peer behind b. Pairs missing from it are only recorded.
+var expectedNATMatrix map[string]bool
+
+type natOutcome struct {
+	A         string `json:"a"`
+	B         string `json:"b"`
+	Connected bool   `json:"connected"`
+	Pair      string `json:"pair,omitempty"`
+	Expected  string `json:"expected,omitempty"`
+}
+
+func init() {
+	for _, nat := range dc.NATTypes {
+		natMatrixKinds = append(natMatrixKinds, string(nat))
+	}
+	for _, a := range natMatrixKinds {
+		for _, b := range natMatrixKinds {
+			a, b := a, b
+			registerTest(&Test{
+				Name:        fmt.Sprintf("nat-matrix[%s,%s]", a, b),
+				Description: fmt.Sprintf("ICE connectivity between a peer behind %s NAT and a peer behind %s NAT", a, b),
+				Tags:        []string{tagNAT, tagSTUN, tagSlow},
+				Requires:    []string{capabilityICE},
+				Weight:      natMatrixWeight(a, b),
+				Peers:       2,
+				NAT:         natMatrixKey(a, b),
+				Run: func(t *testContext) error {
+					return testNATMatrix(t, a, b)
+				},
+			})
+		}
+	}
+}
+
+func natMatrixKey(a, b string) string {
+	return a + "/" + b
+}
+
+func natMatrixWeight(a, b string) int {
+	weight := 3
+	for _, kind := range []string{a, b} {
+		if kind != natNone {
+			weight++
+		}
+	}
+	return weight
+}
+
+func parseNATMatrix(r io.Reader) (map[string]bool, error) {
+	matrix := map[string]bool{}
+	var columns []string
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if columns == nil {
+			columns = fields
+			continue
+		}
+		if len(fields) != len(columns)+1 {
+			return nil, fmt.Errorf("line %d: expected %d columns, got %d", line, len(columns)+1, len(fields))
+		}
+		for i, value := range fields[1:] {
+			switch value {
+			case "yes":
+				matrix[natMatrixKey(fields[0], columns[i])] = true
+			case "no":
+				matrix[natMatrixKey(fields[0], columns[i])] = false
+			default:
+				return nil, fmt.Errorf("line %d: expected yes or no, got %q", line, value)
+			}
+		}
+	}
+	return matrix, scanner.Err()
+}
+
+func loadNATMatrix(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	matrix, err := parseNATMatrix(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return matrix, nil
+}
+
+func newNATPeer(t *testContext, setup *dc.Setup, name, image, kind string, internet *dc.Network) *Computer {
+	if kind == natNone {
+		return t.Computer(setup.NewComputer(name, image, nil, []*dc.Network{internet}))
+	}
+	lan := setup.NewNetwork(name + "-lan")
+	router := setup.NewNATRouter(name+"-router", t.router, dc.NATType(kind), []*dc.Network{lan, internet})
+	return t.Computer(setup.NewComputer(name, image, router, []*dc.Network{lan}))
+}
+
+func (o *natOutcome) check() error {
+	switch {
+	case o.Expected == "yes" && !o.Connected:
+		return fmt.Errorf("peers behind %s and %s NAT did not connect, expected them to", o.A, o.B)
+	case o.Expected == "no" && o.Connected:
+		return fmt.Errorf("peers behind %s and %s NAT connected through %s, expected them not to", o.A, o.B, o.Pair)
+	}
+	return nil
+}
+
+func testNATMatrix(t *testContext, a, b string) (err error) {
+	setup := t.NewSetup()
+	internet := setup.NewNetwork("internet")
+	setup.NewSTUNServer("stun-server", []*dc.Network{internet})
+	peers := []*Computer{
+		newNATPeer(t, setup, "computer", t.image, a, internet),
+		newNATPeer(t, setup, "computer2", t.peerImage, b, internet),
+	}
+	err = t.StartSetup(setup)
+	if err != nil {
+		return err
+	}
+	defer teardown(setup, &err)
+	servers, err := iceServers(setup)
+	if err != nil {
+		return err
+	}
+	results, err := connectICE(peers[0], peers[1], servers, natMatrixConnectTimeout)
+	if err != nil {
+		return err
+	}
+
+	outcome := natOutcome{A: a, B: b, Connected: results[0].Connected() && results[1].Connected()}
+	if outcome.Connected && results[0].Local != nil && results[0].Remote != nil {
+		outcome.Pair = results[0].Local.Type + "/" + results[0].Remote.Type
+	}
+	if expected, found := expectedNATMatrix[natMatrixKey(a, b)]; found {
+		outcome.Expected = "no"
+		if expected {
+			outcome.Expected = "yes"
+		}
+	}
+	t.RecordNATOutcome(outcome)
+	return outcome.check()
+}
+
+type natMatrixCell struct {
+	natOutcome
+	Peers  string `json:"peers"`
+	Status string `json:"status"`
+}
+
+type natMatrix struct {
+	Peers string
+	Kinds []string
+	Rows  []natMatrixRow
+}
+
+type natMatrixRow struct {
+	Kind  string
+	Cells []string
+}
+
+func (c *natMatrixCell) String() string {
+	s := "-"
+	if c.Connected {
+		s = c.Pair
+		if s == "" {
+			s = "yes"
+		}
+	}
+	if c.check() != nil {
+		s += "!"
+	}
+	return s
+}
+
+func newNATMatrices(cells []natMatrixCell) []*natMatrix {
+	byPeers := map[string]map[string]*natMatrixCell{}
+	for i := range cells {
+		cell := &cells[i]
+		if byPeers[cell.Peers] == nil {
+			byPeers[cell.Peers] = map[string]*natMatrixCell{}
+		}
+		byPeers[cell.Peers][natMatrixKey(cell.A, cell.B)] = cell
+	}
+	peers := make([]string, 0, len(byPeers))
+	for p := range byPeers {
+		peers = append(peers, p)
+	}
+	sort.Strings(peers)
+	matrices := []*natMatrix{}
+	for _, p := range peers {
+		m := &natMatrix{Peers: p, Kinds: natMatrixKinds}
+		for _, a := range natMatrixKinds {
+			row := natMatrixRow{Kind: a}
+			for _, b := range natMatrixKinds {
+				s := ""
+				if cell, found := byPeers[p][natMatrixKey(a, b)]; found {
+					s = cell.String()
+				}
+				row.Cells = append(row.Cells, s)
+			}
+			m.Rows = append(m.Rows, row)
+		}
+		matrices = append(matrices, m)
+	}
+	return matrices
+}
+
+func printNATMatrix(w io.Writer, cells []natMatrixCell) {
+	for _, m := range newNATMatrices(cells) {
+		fmt.Fprintf(w, "\nNAT reachability (%s), selected local/remote candidate types, - did not connect, ! unexpected\n", m.Peers)
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "\t%s\n", strings.Join(m.Kinds, "\t"))
+		for _, row := range m.Rows {
+			fmt.Fprintf(tw, "%s\t%s\n", row.Kind, strings.Join(row.Cells, "\t"))
+		}
+		tw.Flush()
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNATMatrix(t *testing.T) {
+	matrix, err := parseNATMatrix(strings.NewReader(`# comment
+       none  symmetric
+none       yes   yes
+symmetric  yes   no
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]bool{
+		"none/none":           true,
+		"none/symmetric":      true,
+		"symmetric/none":      true,
+		"symmetric/symmetric": false,
+	}, matrix)
+
+	_, err = parseNATMatrix(strings.NewReader("none\nnone yes no\n"))
+	assert.NotNil(t, err)
+	_, err = parseNATMatrix(strings.NewReader("none\nnone maybe\n"))
+	assert.NotNil(t, err)
+}
+
+func TestExpectedNATMatrix(t *testing.T) {
+	matrix, err := loadNATMatrix("nat-matrix.txt")
+	assert.Nil(t, err)
+	for _, a := range natMatrixKinds {
+		for _, b := range natMatrixKinds {
+			expected, found := matrix[natMatrixKey(a, b)]
+			if assert.True(t, found, natMatrixKey(a, b)) {
+				assert.Equal(t, expected, matrix[natMatrixKey(b, a)], natMatrixKey(a, b))
+			}
+		}
+	}
+}
+
+func TestNATOutcomeCheck(t *testing.T) {
+	assert.Nil(t, (&natOutcome{A: "none", B: "none", Connected: true, Expected: "yes"}).check())
+	assert.Nil(t, (&natOutcome{A: "symmetric", B: "symmetric"}).check())
+	assert.NotNil(t, (&natOutcome{A: "none", B: "none", Expected: "yes"}).check())
+	assert.NotNil(t, (&natOutcome{A: "symmetric", B: "symmetric", Connected: true, Pair: "prflx/srflx", Expected: "no"}).check())
+}
+
+func TestPrintNATMatrix(t *testing.T) {
+	saved := natMatrixKinds
+	defer func() { natMatrixKinds = saved }()
+	natMatrixKinds = []string{"none", "symmetric"}
+
+	var out bytes.Buffer
+	printNATMatrix(&out, []natMatrixCell{
+		{natOutcome: natOutcome{A: "none", B: "none", Connected: true, Pair: "host/host", Expected: "yes"}, Peers: "pion,pion"},
+		{natOutcome: natOutcome{A: "none", B: "symmetric", Connected: true, Pair: "host/prflx", Expected: "yes"}, Peers: "pion,pion"},
+		{natOutcome: natOutcome{A: "symmetric", B: "symmetric", Connected: true, Pair: "srflx/prflx", Expected: "no"}, Peers: "pion,pion"},
+	})
+	assert.Equal(t, `
+NAT reachability (pion,pion), selected local/remote candidate types, - did not connect, ! unexpected
+           none       symmetric
+none       host/host  host/prflx
+symmetric             srflx/prflx!
+`, out.String())
+}
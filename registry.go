@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/seppo0010/vortices/agent"
+)
+
+const (
+	tagNAT  = "nat"
+	tagSTUN = "stun"
+	tagTURN = "turn"
+	tagIPv6 = "ipv6"
+	tagSlow = "slow"
+
+	tagSignaling = "signaling"
+	tagTrickle   = "trickle"
+	tagTCP       = "tcp"
+	tagMDNS      = "mdns"
+)
+
+const (
+	capabilityGatherCandidates = agent.CapabilityGatherCandidates
+	capabilityPing             = agent.CapabilityPing
+	capabilityGetIPFromSTUN    = agent.CapabilityGetIPFromSTUN
+	capabilityICE              = agent.CapabilityICE
+	capabilityTrickleICE       = agent.CapabilityTrickleICE
+	capabilityICETCP           = agent.CapabilityICETCP
+	capabilityMDNS             = agent.CapabilityMDNS
+)
+
+type Test struct {
+	Name        string
+	Description string
+	Tags        []string
+	Requires    []string
+	Weight      int
+	Timeout     time.Duration
+	Peers       int
+	NAT         string
+	Run         func(t *testContext) error
+}
+
+var registeredTests = []*Test{}
+
+func registerTest(test *Test) {
+	for _, t := range registeredTests {
+		if t.Name == test.Name {
+			panic(fmt.Sprintf("test %s registered twice", test.Name))
+		}
+	}
+	registeredTests = append(registeredTests, test)
+	sort.Slice(registeredTests, func(i, j int) bool { return registeredTests[i].Name < registeredTests[j].Name })
+}
+
+func (t *Test) tagSet() map[string]bool {
+	tags := map[string]bool{}
+	for _, tag := range t.Tags {
+		tags[tag] = true
+	}
+	return tags
+}
+
+type testSelector struct {
+	patterns []string
+	regex    *regexp.Regexp
+	tags     tagExpr
+}
+
+func newTestSelector(patterns []string, regex, tags string) (*testSelector, error) {
+	s := &testSelector{patterns: patterns}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid test pattern %q: %s", pattern, err.Error())
+		}
+	}
+	if regex != "" {
+		re, err := regexp.Compile(regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid test regex %q: %s", regex, err.Error())
+		}
+		s.regex = re
+	}
+	if tags != "" {
+		expr, err := parseTagExpr(tags)
+		if err != nil {
+			return nil, err
+		}
+		s.tags = expr
+	}
+	return s, nil
+}
+
+func (s *testSelector) matches(t *Test) bool {
+	if len(s.patterns) > 0 {
+		found := false
+		for _, pattern := range s.patterns {
+			if matched, _ := path.Match(pattern, t.Name); matched {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if s.regex != nil && !s.regex.MatchString(t.Name) {
+		return false
+	}
+	if s.tags != nil && !s.tags(t.tagSet()) {
+		return false
+	}
+	return true
+}
+
+// selectsTag reports whether any of the selected tests has the tag.
+func (s *testSelector) selectsTag(tests []*Test, tag string) bool {
+	for _, t := range tests {
+		if s.matches(t) && t.tagSet()[tag] {
+			return true
+		}
+	}
+	return false
+}
+
+func listTests(w io.Writer, tests []*Test) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTAGS\tREQUIRES\tDESCRIPTION")
+	for _, t := range tests {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", t.Name, strings.Join(t.Tags, ","), strings.Join(t.Requires, ","), t.Description)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTestSelector(t *testing.T) {
+	tests := []*Test{
+		{Name: "ice-candidates-gather"},
+		{Name: "gateway", Tags: []string{tagNAT}},
+		{Name: "stun", Tags: []string{tagNAT, tagSTUN}},
+	}
+	selected := func(patterns []string, regex, tags string) []string {
+		selector, err := newTestSelector(patterns, regex, tags)
+		if !assert.Nil(t, err) {
+			return nil
+		}
+		names := []string{}
+		for _, test := range tests {
+			if selector.matches(test) {
+				names = append(names, test.Name)
+			}
+		}
+		return names
+	}
+	assert.Equal(t, []string{"ice-candidates-gather", "gateway", "stun"}, selected(nil, "", ""))
+	assert.Equal(t, []string{"stun"}, selected([]string{"stun"}, "", ""))
+	assert.Equal(t, []string{"ice-candidates-gather", "gateway"}, selected([]string{"ice-*", "gate*"}, "", ""))
+	assert.Equal(t, []string{"gateway", "stun"}, selected(nil, "^(gate|st)", ""))
+	assert.Equal(t, []string{"gateway"}, selected(nil, "", "nat && !stun"))
+	assert.Equal(t, []string{"stun"}, selected([]string{"*"}, "u", "nat"))
+
+	_, err := newTestSelector([]string{"["}, "", "")
+	assert.NotNil(t, err)
+	_, err = newTestSelector(nil, "(", "")
+	assert.NotNil(t, err)
+}
+
+func TestTestSelectorSelectsTag(t *testing.T) {
+	tests := []*Test{
+		{Name: "gateway", Tags: []string{tagNAT}},
+		{Name: "signaling-relay", Tags: []string{tagNAT, tagSignaling}},
+	}
+	selector, err := newTestSelector([]string{"gateway"}, "", "")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.False(t, selector.selectsTag(tests, tagSignaling))
+	selector, err = newTestSelector(nil, "", "nat")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, selector.selectsTag(tests, tagSignaling))
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type reportSetup struct {
+	ID          string `json:"id"`
+	ArtifactDir string `json:"artifact_dir"`
+}
+
+type reportTest struct {
+	Name          string             `json:"name"`
+	Status        string             `json:"status"`
+	Duration      float64            `json:"duration_seconds"`
+	QueueTime     float64            `json:"queue_seconds"`
+	Attempts      int                `json:"attempts"`
+	Error         string             `json:"error,omitempty"`
+	SetupID       string             `json:"setup_id,omitempty"`
+	ArtifactDir   string             `json:"artifact_dir,omitempty"`
+	Setups        []reportSetup      `json:"setups,omitempty"`
+	Metrics       map[string]float64 `json:"metrics,omitempty"`
+	AttemptErrors []string           `json:"attempt_errors,omitempty"`
+	Topologies    []*topology        `json:"topologies,omitempty"`
+	Observations  observations       `json:"observations"`
+	Artifacts     []reportArtifact   `json:"artifacts,omitempty"`
+}
+
+type reportArtifact struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type report struct {
+	Started   time.Time       `json:"started"`
+	Duration  float64         `json:"duration_seconds"`
+	Image     string          `json:"image"`
+	Tests     []*reportTest   `json:"tests"`
+	Interop   []interopCell   `json:"interop,omitempty"`
+	NATMatrix []natMatrixCell `json:"nat_matrix,omitempty"`
+	Trickle   []trickleRow    `json:"trickle,omitempty"`
+}
+
+func newReport(started time.Time, image string, results []*testResult) *report {
+	r := &report{
+		Started:  started,
+		Duration: time.Since(started).Seconds(),
+		Image:    image,
+		Tests:    []*reportTest{},
+	}
+	for _, res := range results {
+		test := &reportTest{
+			Name:      res.testName,
+			Status:    res.status,
+			Duration:  res.duration.Seconds(),
+			QueueTime: res.queueTime.Seconds(),
+			Attempts:  len(res.attempts),
+		}
+		if res.err != nil {
+			test.Error = res.err.Error()
+		}
+		for _, err := range res.attempts {
+			if err != nil {
+				test.AttemptErrors = append(test.AttemptErrors, err.Error())
+			}
+		}
+		if res.context != nil {
+			for _, setup := range res.context.Setups() {
+				test.Setups = append(test.Setups, reportSetup{ID: setup.ID, ArtifactDir: setup.ArtifactDir})
+				test.Topologies = append(test.Topologies, newTopology(setup))
+				for _, file := range setup.Artifacts().Files {
+					test.Artifacts = append(test.Artifacts, reportArtifact{Kind: file.Kind, Name: file.Name, Path: path.Join(setup.ArtifactDir, file.Path)})
+				}
+			}
+			test.Observations = res.context.Observations()
+			if test.Observations.NAT != nil && res.job != nil {
+				r.NATMatrix = append(r.NATMatrix, natMatrixCell{
+					natOutcome: *test.Observations.NAT,
+					Peers:      res.job.peers[0].Name + "," + res.job.peers[1].Name,
+					Status:     res.status,
+				})
+			}
+			for _, timings := range test.Observations.Trickle {
+				if res.job != nil {
+					r.Trickle = append(r.Trickle, trickleRow{
+						trickleTimings: timings,
+						Peers:          res.job.peers[0].Name + "," + res.job.peers[1].Name,
+						Status:         res.status,
+					})
+				}
+			}
+			if len(test.Setups) > 0 {
+				test.SetupID = test.Setups[0].ID
+				test.ArtifactDir = test.Setups[0].ArtifactDir
+			}
+			if metrics := res.context.Metrics(); len(metrics) > 0 {
+				test.Metrics = metrics
+			}
+		}
+		r.Tests = append(r.Tests, test)
+		if res.job != nil && res.job.interop {
+			r.Interop = append(r.Interop, interopCell{
+				NAT:    res.job.test.NAT,
+				A:      res.job.peers[0].Name,
+				B:      res.job.peers[1].Name,
+				Test:   res.job.test.Name,
+				Status: res.status,
+			})
+		}
+	}
+	return r
+}
+
+func (r *report) count(status string) int {
+	n := 0
+	for _, test := range r.Tests {
+		if test.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *report) ok() bool {
+	return r.count(statusFailed) == 0
+}
+
+func (r *report) writeJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name       string          `xml:"name,attr"`
+	ClassName  string          `xml:"classname,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Failure    *junitFailure   `xml:"failure,omitempty"`
+	Skipped    *struct{}       `xml:"skipped,omitempty"`
+	SystemOut  string          `xml:"system-out,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+func (r *report) writeJUnit(path string) error {
+	suite := junitTestSuite{
+		Name:      "vortices",
+		Tests:     len(r.Tests),
+		Failures:  r.count(statusFailed),
+		Skipped:   r.count(statusSkipped),
+		Time:      fmt.Sprintf("%.3f", r.Duration),
+		Timestamp: r.Started.UTC().Format("2006-01-02T15:04:05"),
+	}
+	for _, test := range r.Tests {
+		tc := junitTestCase{
+			Name:      test.Name,
+			ClassName: "vortices",
+			Time:      fmt.Sprintf("%.3f", test.Duration),
+			Properties: []junitProperty{
+				{Name: "status", Value: test.Status},
+				{Name: "attempts", Value: fmt.Sprint(test.Attempts)},
+			},
+		}
+		if test.SetupID != "" {
+			tc.Properties = append(tc.Properties, junitProperty{Name: "setup_id", Value: test.SetupID}, junitProperty{Name: "artifact_dir", Value: test.ArtifactDir})
+		}
+		names := make([]string, 0, len(test.Metrics))
+		for name := range test.Metrics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			tc.Properties = append(tc.Properties, junitProperty{Name: "metric." + name, Value: fmt.Sprint(test.Metrics[name])})
+		}
+		switch test.Status {
+		case statusFailed:
+			tc.Failure = &junitFailure{Message: test.Error, Text: strings.Join(test.AttemptErrors, "\n")}
+		case statusSkipped:
+			tc.Skipped = &struct{}{}
+		case statusFlaky:
+			tc.SystemOut = fmt.Sprintf("flaky: passed after %d attempts\n%s", test.Attempts, strings.Join(test.AttemptErrors, "\n"))
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append([]byte(xml.Header), data...), 0644)
+}
+
+func (r *report) printSummary(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TEST\tSTATUS\tATTEMPTS\tQUEUED\tDURATION\tERROR")
+	for _, test := range r.Tests {
+		if test.Status == statusSkipped {
+			fmt.Fprintf(tw, "%s\t%s\t\t\t\t%s\n", test.Name, test.Status, test.Error)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n",
+			test.Name,
+			test.Status,
+			test.Attempts,
+			(time.Duration(test.QueueTime * float64(time.Second))).Round(time.Millisecond),
+			(time.Duration(test.Duration * float64(time.Second))).Round(time.Millisecond),
+			strings.SplitN(test.Error, "\n", 2)[0],
+		)
+	}
+	tw.Flush()
+	if len(r.Interop) > 0 {
+		printInteropMatrix(w, r.Interop)
+		fmt.Fprintln(w)
+	}
+	if len(r.NATMatrix) > 0 {
+		printNATMatrix(w, r.NATMatrix)
+		fmt.Fprintln(w)
+	}
+	if len(r.Trickle) > 0 {
+		printTrickleTimings(w, r.Trickle)
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%d passed, %d flaky, %d failed, %d skipped in %s\n",
+		r.count(statusPassed), r.count(statusFlaky), r.count(statusFailed), r.count(statusSkipped),
+		(time.Duration(r.Duration * float64(time.Second))).Round(time.Millisecond))
+}
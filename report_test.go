@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testReport() *report {
+	tc := newTestContext(context.Background(), "gateway", "image", "router")
+	tc.NewSetup()
+	tc.Metric("ping_rtt_avg_ms", 1.5)
+	return newReport(time.Now(), "examples/pion", []*testResult{
+		{testName: "gateway", status: statusPassed, attempts: []error{nil}, duration: time.Second, context: tc},
+		{testName: "stun", status: statusFailed, err: errors.New("no route"), attempts: []error{errors.New("no route")}},
+		{testName: "flaky", status: statusFlaky, attempts: []error{errors.New("lost packet"), nil}},
+		{testName: "skipped", status: statusSkipped},
+	})
+}
+
+func TestReportJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vortices-report")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	r := testReport()
+	assert.Nil(t, r.writeJSON(path.Join(dir, "report.json")))
+	data, err := ioutil.ReadFile(path.Join(dir, "report.json"))
+	assert.Nil(t, err)
+	var parsed report
+	assert.Nil(t, json.Unmarshal(data, &parsed))
+	if !assert.Equal(t, 4, len(parsed.Tests)) {
+		return
+	}
+	assert.Equal(t, "gateway", parsed.Tests[0].Name)
+	assert.Equal(t, r.Tests[0].SetupID, parsed.Tests[0].SetupID)
+	assert.NotEqual(t, "", parsed.Tests[0].ArtifactDir)
+	assert.Equal(t, map[string]float64{"ping_rtt_avg_ms": 1.5}, parsed.Tests[0].Metrics)
+	assert.Equal(t, "no route", parsed.Tests[1].Error)
+	assert.False(t, r.ok())
+}
+
+func TestReportJUnit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vortices-report")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	assert.Nil(t, testReport().writeJUnit(path.Join(dir, "junit.xml")))
+	data, err := ioutil.ReadFile(path.Join(dir, "junit.xml"))
+	assert.Nil(t, err)
+	var suite junitTestSuite
+	assert.Nil(t, xml.Unmarshal(data, &suite))
+	assert.Equal(t, 4, suite.Tests)
+	assert.Equal(t, 1, suite.Failures)
+	assert.Equal(t, 1, suite.Skipped)
+	if !assert.Equal(t, 4, len(suite.TestCases)) {
+		return
+	}
+	assert.NotNil(t, suite.TestCases[1].Failure)
+	assert.NotNil(t, suite.TestCases[3].Skipped)
+	assert.True(t, strings.HasPrefix(suite.TestCases[2].SystemOut, "flaky"))
+}
+
+func TestReportSummary(t *testing.T) {
+	var out bytes.Buffer
+	testReport().printSummary(&out)
+	assert.Contains(t, out.String(), "stun     failed")
+	assert.Contains(t, out.String(), "1 passed, 1 flaky, 1 failed, 1 skipped")
+}
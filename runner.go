@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	dc "github.com/seppo0010/vortices/dockercompose"
+)
+
+const (
+	statusPassed  = "passed"
+	statusFailed  = "failed"
+	statusFlaky   = "flaky"
+	statusSkipped = "skipped"
+)
+
+type runConfig struct {
+	impls     []implementation
+	router    string
+	signaling string
+	timeout   time.Duration
+	retries   int
+	grace     time.Duration
+	flakyLog  string
+	ready     time.Duration
+	transport string
+}
+
+type testResult struct {
+	testName  string
+	job       *testJob
+	status    string
+	err       error
+	attempts  []error
+	queueTime time.Duration
+	duration  time.Duration
+	context   *testContext
+}
+
+// runAttempt runs the test once. When the test does not return after timing
+// out and being torn down, running is closed once it finally does.
+func runAttempt(job *testJob, cfg *runConfig) (tc *testContext, running <-chan struct{}, err error) {
+	t := job.test
+	timeout := cfg.timeout
+	if t.Timeout > 0 {
+		timeout = t.Timeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	tc = newTestContext(ctx, job.name, job.peers[0].Image, cfg.router)
+	tc.peerImage = job.peers[1].Image
+	tc.signaling = cfg.signaling
+	tc.transport = cfg.transport
+	// agents predating /version have no /health to wait for
+	if job.peers[0].Version != nil && job.peers[1].Version != nil {
+		tc.start = dc.StartOptions{WaitReady: true, ReadyTimeout: cfg.ready, Ready: tc.agentReady}
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- t.Run(tc)
+	}()
+	select {
+	case err = <-done:
+		return tc, nil, err
+	case <-ctx.Done():
+	}
+
+	log.Printf("test %v timed out after %s, tearing it down", job.name, timeout)
+	err = fmt.Errorf("timed out after %s", timeout)
+	select {
+	case <-done:
+		return tc, nil, err
+	case <-time.After(cfg.grace):
+		log.Printf("test %v did not return %s after timing out", job.name, cfg.grace)
+		for _, setup := range tc.Setups() {
+			teardown(setup, &err)
+		}
+	}
+	returned := make(chan struct{})
+	go func() {
+		<-done
+		close(returned)
+	}()
+	return tc, returned, err
+}
+
+func runTest(job *testJob, cfg *runConfig, sched *scheduler) *testResult {
+	t := job.test
+	res := &testResult{testName: job.name, job: job}
+	queued := time.Now()
+	sched.acquire(t.Weight)
+	release := true
+	defer func() {
+		if release {
+			sched.release(t.Weight)
+		}
+	}()
+	res.queueTime = time.Since(queued)
+
+	log.Printf("running test %v (queued for %s)", res.testName, res.queueTime.Round(time.Millisecond))
+	start := time.Now()
+	for attempt := 1; attempt <= cfg.retries+1; attempt++ {
+		var running <-chan struct{}
+		res.context, running, res.err = runAttempt(job, cfg)
+		res.attempts = append(res.attempts, res.err)
+		if running != nil {
+			// another attempt would run next to this one, so keep its slot
+			// until it returns and give up on it
+			log.Printf("test %v is still running, not retrying it", res.testName)
+			release = false
+			go func() {
+				<-running
+				sched.release(t.Weight)
+			}()
+			break
+		}
+		if res.err == nil {
+			break
+		}
+		if attempt <= cfg.retries {
+			log.Printf("test %v failed on attempt %d, retrying: %s", res.testName, attempt, res.err.Error())
+		}
+	}
+	res.duration = time.Since(start)
+	switch {
+	case res.err != nil:
+		res.status = statusFailed
+		log.Printf("test %v failed after %s: %s", res.testName, res.duration.Round(time.Millisecond), res.err.Error())
+	case len(res.attempts) > 1:
+		res.status = statusFlaky
+		log.Printf("test %v is flaky: passed on attempt %d in %s", res.testName, len(res.attempts), res.duration.Round(time.Millisecond))
+	default:
+		res.status = statusPassed
+		log.Printf("finished OK test %v in %s", res.testName, res.duration.Round(time.Millisecond))
+	}
+	return res
+}
+
+func logFlaky(path string, res *testResult) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	failures := []string{}
+	for _, err := range res.attempts {
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	return json.NewEncoder(f).Encode(map[string]interface{}{
+		"time":     time.Now().UTC().Format(time.RFC3339),
+		"test":     res.testName,
+		"attempts": len(res.attempts),
+		"failures": failures,
+	})
+}
+
+func runTests(cfg *runConfig, selector *testSelector, sched *scheduler) []*testResult {
+	jobs := []*testJob{}
+	for _, t := range registeredTests {
+		jobs = append(jobs, expandTests(t, cfg.impls)...)
+	}
+	results := make([]*testResult, len(jobs))
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		if !selector.matches(job.test) {
+			log.Printf("skipped test %v", job.name)
+			results[i] = &testResult{testName: job.name, job: job, status: statusSkipped}
+			continue
+		}
+		if unsupported := unsupportedCapabilities(job.test, job.peers); len(unsupported) > 0 {
+			err := errors.New(strings.Join(unsupported, ", "))
+			log.Printf("skipped test %v: %s", job.name, err.Error())
+			results[i] = &testResult{testName: job.name, job: job, status: statusSkipped, err: err}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, job *testJob) {
+			results[i] = runTest(job, cfg, sched)
+			wg.Done()
+		}(i, job)
+	}
+	wg.Wait()
+	for _, res := range results {
+		if res.status == statusFlaky && cfg.flakyLog != "" {
+			err := logFlaky(cfg.flakyLog, res)
+			if err != nil {
+				log.Printf("failed to write flaky test log %s: %s", cfg.flakyLog, err.Error())
+			}
+		}
+	}
+	return results
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testJobFor(t *Test) *testJob {
+	return expandTests(t, []implementation{{Name: "agent", Image: "agent"}})[0]
+}
+
+func TestRunTestRetries(t *testing.T) {
+	cfg := &runConfig{timeout: time.Second, retries: 2, grace: time.Second}
+	sched := newScheduler(1, 1)
+
+	calls := 0
+	res := runTest(testJobFor(&Test{Name: "flaky", Run: func(t *testContext) error {
+		calls++
+		if calls == 1 {
+			return errors.New("network hiccup")
+		}
+		return nil
+	}}), cfg, sched)
+	assert.Equal(t, statusFlaky, res.status)
+	assert.Equal(t, 2, len(res.attempts))
+
+	res = runTest(testJobFor(&Test{Name: "broken", Run: func(t *testContext) error {
+		return errors.New("broken")
+	}}), cfg, sched)
+	assert.Equal(t, statusFailed, res.status)
+	assert.Equal(t, 3, len(res.attempts))
+
+	res = runTest(testJobFor(&Test{Name: "ok", Run: func(t *testContext) error {
+		return nil
+	}}), cfg, sched)
+	assert.Equal(t, statusPassed, res.status)
+}
+
+func TestRunTestTimeout(t *testing.T) {
+	cfg := &runConfig{timeout: time.Hour, grace: time.Second}
+	res := runTest(testJobFor(&Test{Name: "hung", Timeout: 10 * time.Millisecond, Run: func(t *testContext) error {
+		<-t.Done()
+		return t.Err()
+	}}), cfg, newScheduler(1, 1))
+	assert.Equal(t, statusFailed, res.status)
+	assert.EqualError(t, res.err, "timed out after 10ms")
+}
+
+func TestRunTestAbandoned(t *testing.T) {
+	cfg := &runConfig{timeout: time.Hour, retries: 2, grace: 10 * time.Millisecond}
+	sched := newScheduler(1, 1)
+	unblock := make(chan struct{})
+	res := runTest(testJobFor(&Test{Name: "stuck", Timeout: 10 * time.Millisecond, Run: func(t *testContext) error {
+		<-unblock
+		return nil
+	}}), cfg, sched)
+	assert.Equal(t, statusFailed, res.status)
+	assert.Equal(t, 1, len(res.attempts))
+
+	acquired := make(chan struct{})
+	go func() {
+		sched.acquire(1)
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("the slot of a test still running was released")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(unblock)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("the slot was not released after the test returned")
+	}
+}
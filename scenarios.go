@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/seppo0010/vortices/agent"
+	dc "github.com/seppo0010/vortices/dockercompose"
+)
+
+func init() {
+	registerTest(&Test{
+		Name:        "ice-candidates-gather",
+		Description: "gathered host candidates match the IP addresses of every network the computer is in",
+		Requires:    []string{capabilityGatherCandidates},
+		Weight:      2,
+		Run:         testICECandidatesGather,
+	})
+	registerTest(&Test{
+		Name:        "gateway",
+		Description: "a computer behind a router can ping a computer on the internet",
+		Tags:        []string{tagNAT},
+		Requires:    []string{capabilityPing},
+		Weight:      3,
+		Peers:       2,
+		NAT:         string(dc.NATPortRestrictedCone),
+		Run:         testGateway,
+	})
+	registerTest(&Test{
+		Name:        "ice-connect",
+		Description: "a computer behind a router connects with ICE to a computer on the internet",
+		Tags:        []string{tagNAT, tagSTUN},
+		Requires:    []string{capabilityICE},
+		Weight:      4,
+		Peers:       2,
+		NAT:         string(dc.NATPortRestrictedCone),
+		Run:         testICEConnect,
+	})
+	registerTest(&Test{
+		Name:        "stun",
+		Description: "the address reported by a STUN server is the router's internet address",
+		Tags:        []string{tagNAT, tagSTUN},
+		Requires:    []string{capabilityGetIPFromSTUN},
+		Weight:      3,
+		Run:         testStun,
+	})
+}
+
+func testICECandidatesGather(t *testContext) (err error) {
+	setup := t.NewSetup()
+	network1 := setup.NewNetwork("network1")
+	network2 := setup.NewNetwork("network2")
+	computers := []*dc.Computer{
+		setup.NewComputer("computer", t.image, nil, []*dc.Network{network1, network2}),
+		setup.NewComputer("computer2", t.image, nil, []*dc.Network{network1}),
+	}
+	err = t.StartSetup(setup)
+	if err != nil {
+		return err
+	}
+	defer teardown(setup, &err)
+	for _, computer := range computers {
+		candidates, err := t.Computer(computer).GatherCandidates(agent.GatherOptions{})
+		if err != nil {
+			return err
+		}
+		ips, err := computer.GetAllIPAddresses()
+		if err != nil {
+			return err
+		}
+		err = checkCandidatesMatch(candidates, ips)
+		if err != nil {
+			return err
+		}
+		t.Metric(computer.Name+".candidates", float64(len(candidates)))
+	}
+	return nil
+}
+
+func testGateway(t *testContext) (err error) {
+	setup := t.NewSetup()
+	network1 := setup.NewNetwork("network1")
+	internet := setup.NewNetwork("internet")
+	gateway := setup.NewRouter("myrouter", t.router, []*dc.Network{network1, internet})
+	computers := []*dc.Computer{
+		setup.NewComputer("computer", t.image, gateway, []*dc.Network{network1}),
+		setup.NewComputer("computer2", t.peerImage, nil, []*dc.Network{internet}),
+	}
+	err = t.StartSetup(setup)
+	if err != nil {
+		return err
+	}
+	defer teardown(setup, &err)
+	ips, err := computers[1].GetAllIPAddresses()
+	if err != nil {
+		return err
+	}
+	times, err := t.Computer(computers[0]).Ping(ips[0])
+	if err != nil {
+		return err
+	}
+	if len(times) > 0 {
+		var total time.Duration
+		for _, rtt := range times {
+			total += rtt
+		}
+		t.Metric("ping_rtt_avg_ms", float64(total)/float64(len(times))/float64(time.Millisecond))
+	}
+	return nil
+}
+
+func testStun(t *testContext) (err error) {
+	setup := t.NewSetup()
+	network1 := setup.NewNetwork("network1")
+	internet := setup.NewNetwork("internet")
+	routerComputer := setup.NewRouter("myrouter", t.router, []*dc.Network{network1, internet})
+	computer := setup.NewComputer("computer", t.image, routerComputer, []*dc.Network{network1})
+	stun := setup.NewSTUNServer("stun-server", []*dc.Network{internet})
+	err = t.StartSetup(setup)
+	if err != nil {
+		return err
+	}
+	defer teardown(setup, &err)
+	ips, err := stun.GetAllIPAddresses()
+	if err != nil {
+		return err
+	}
+	stunIP, err := t.Computer(computer).GetIPFromSTUN(ips[0] + ":3478")
+	if err != nil {
+		return err
+	}
+	routerIP, err := routerComputer.GetIPAddressForNetwork(internet)
+	if err != nil {
+		return err
+	}
+	if stunIP != routerIP {
+		return fmt.Errorf("expected stun ip (%s) to match router ip (%s)", stunIP, routerIP)
+	}
+	return nil
+}
+
+func testICEConnect(t *testContext) (err error) {
+	setup := t.NewSetup()
+	network1 := setup.NewNetwork("network1")
+	internet := setup.NewNetwork("internet")
+	router := setup.NewRouter("myrouter", t.router, []*dc.Network{network1, internet})
+	computers := []*dc.Computer{
+		setup.NewComputer("computer", t.image, router, []*dc.Network{network1}),
+		setup.NewComputer("computer2", t.peerImage, nil, []*dc.Network{internet}),
+	}
+	setup.NewSTUNServer("stun-server", []*dc.Network{internet})
+	err = t.StartSetup(setup)
+	if err != nil {
+		return err
+	}
+	defer teardown(setup, &err)
+	servers, err := iceServers(setup)
+	if err != nil {
+		return err
+	}
+	states, err := connectICE(t.Computer(computers[0]), t.Computer(computers[1]), servers, 20*time.Second)
+	if err != nil {
+		return err
+	}
+	for i, state := range states {
+		if !state.Connected() {
+			return fmt.Errorf("%s did not connect: state %s %s", computers[i].Name, state.State, state.Error)
+		}
+	}
+	routerIP, err := router.GetIPAddressForNetwork(internet)
+	if err != nil {
+		return err
+	}
+	if remote := states[1].Remote; remote == nil || remote.Address != routerIP {
+		return fmt.Errorf("expected %s to reach %s through the router's address %s, selected %v", computers[1].Name, computers[0].Name, routerIP, remote)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import "sync"
+
+// scheduler hands out slots to tests in the order they asked for them,
+// limiting both how many tests run at once and the sum of their weights.
+type scheduler struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	maxTests  int
+	maxWeight int
+	running   int
+	weight    int
+	queue     []*int
+}
+
+func newScheduler(maxTests, maxWeight int) *scheduler {
+	if maxTests < 1 {
+		maxTests = 1
+	}
+	if maxWeight < 1 {
+		maxWeight = 1
+	}
+	s := &scheduler{maxTests: maxTests, maxWeight: maxWeight}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *scheduler) clamp(weight int) int {
+	if weight < 1 {
+		return 1
+	}
+	if weight > s.maxWeight {
+		return s.maxWeight
+	}
+	return weight
+}
+
+func (s *scheduler) acquire(weight int) {
+	weight = s.clamp(weight)
+	ticket := new(int)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue = append(s.queue, ticket)
+	for s.queue[0] != ticket || s.running >= s.maxTests || s.weight+weight > s.maxWeight {
+		s.cond.Wait()
+	}
+	s.queue = s.queue[1:]
+	s.running++
+	s.weight += weight
+	s.cond.Broadcast()
+}
+
+func (s *scheduler) release(weight int) {
+	weight = s.clamp(weight)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	s.weight -= weight
+	s.cond.Broadcast()
+}
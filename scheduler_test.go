@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulerLimits(t *testing.T) {
+	s := newScheduler(2, 5)
+	var mu sync.Mutex
+	running, weight, maxRunning, maxWeight := 0, 0, 0, 0
+	var wg sync.WaitGroup
+	for _, w := range []int{3, 2, 2, 1, 4, 10, 1} {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			s.acquire(w)
+			mu.Lock()
+			running++
+			weight += s.clamp(w)
+			if running > maxRunning {
+				maxRunning = running
+			}
+			if weight > maxWeight {
+				maxWeight = weight
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			running--
+			weight -= s.clamp(w)
+			mu.Unlock()
+			s.release(w)
+		}(w)
+	}
+	wg.Wait()
+	assert.True(t, maxRunning <= 2, "at most 2 tests at once, got %d", maxRunning)
+	assert.True(t, maxWeight <= 5, "at most weight 5 at once, got %d", maxWeight)
+}
+
+func TestSchedulerFIFO(t *testing.T) {
+	s := newScheduler(1, 1)
+	s.acquire(1)
+	order := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			s.acquire(1)
+			order <- i
+			s.release(1)
+		}(i)
+		for {
+			s.mu.Lock()
+			queued := len(s.queue)
+			s.mu.Unlock()
+			if queued == i+1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	s.release(1)
+	assert.Equal(t, 0, <-order)
+	assert.Equal(t, 1, <-order)
+	assert.Equal(t, 2, <-order)
+}
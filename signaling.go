@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	dc "github.com/seppo0010/vortices/dockercompose"
+)
+
+func init() {
+	registerTest(&Test{
+		Name:        "signaling-relay",
+		Description: "computers behind a router and on the internet exchange an offer and an answer through the signaling server",
+		Tags:        []string{tagNAT, tagSignaling},
+		Weight:      4,
+		Peers:       2,
+		NAT:         string(dc.NATPortRestrictedCone),
+		Run:         testSignalingRelay,
+	})
+}
+
+// signalingPeer talks to a signaling server from inside a computer, the way
+// an agent doing its own signaling would.
+type signalingPeer struct {
+	server   *dc.SignalingServer
+	computer *Computer
+	name     string
+}
+
+func newSignalingPeer(server *dc.SignalingServer, computer *Computer, name string) *signalingPeer {
+	return &signalingPeer{server: server, computer: computer, name: name}
+}
+
+func (p *signalingPeer) do(method, path string, body []byte) ([]byte, error) {
+	u := p.server.URL() + "/rooms/" + url.PathEscape(p.computer.Environment["VORTICES_SIGNALING_ROOM"]) + path
+	req, err := http.NewRequestWithContext(p.computer.test, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := &http.Client{Transport: p.computer.ExecOutboundTransport()}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, res.Status, bytes.TrimSpace(data))
+	}
+	return data, nil
+}
+
+func (p *signalingPeer) Send(to, messageType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(&dc.SignalingMessage{From: p.name, To: to, Type: messageType, Payload: data})
+	if err != nil {
+		return err
+	}
+	_, err = p.do(http.MethodPost, "/messages", body)
+	return err
+}
+
+// Receive waits for the messages addressed to the peer after the given id.
+func (p *signalingPeer) Receive(after int) ([]*dc.SignalingMessage, error) {
+	data, err := p.do(http.MethodGet, fmt.Sprintf("/messages?peer=%s&after=%d", url.QueryEscape(p.name), after), nil)
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		Messages []*dc.SignalingMessage `json:"messages"`
+	}
+	err = json.Unmarshal(data, &res)
+	return res.Messages, err
+}
+
+func checkSignalingMessage(messages []*dc.SignalingMessage, from, messageType string) error {
+	if found := dc.FilterSignalingMessages(messages, from, messageType); len(found) != 1 {
+		return fmt.Errorf("expected one %s from %s in the signaling log, got %d", messageType, from, len(found))
+	}
+	return nil
+}
+
+func testSignalingRelay(t *testContext) (err error) {
+	setup := t.NewSetup()
+	network1 := setup.NewNetwork("network1")
+	internet := setup.NewNetwork("internet")
+	router := setup.NewRouter("myrouter", t.router, []*dc.Network{network1, internet})
+	server := setup.NewSignalingServer("signaling", t.signaling, []*dc.Network{internet})
+	computers := []*Computer{
+		t.Computer(setup.NewComputer("computer", t.image, router, []*dc.Network{network1})),
+		t.Computer(setup.NewComputer("computer2", t.peerImage, nil, []*dc.Network{internet})),
+	}
+	err = t.StartSetup(setup)
+	if err != nil {
+		return err
+	}
+	defer teardown(setup, &err)
+
+	offerer := newSignalingPeer(server, computers[0], "offerer")
+	answerer := newSignalingPeer(server, computers[1], "answerer")
+	err = offerer.Send("", "offer", map[string]string{"sdp": "offer"})
+	if err != nil {
+		return err
+	}
+	received, err := answerer.Receive(0)
+	if err != nil {
+		return err
+	}
+	if err = checkSignalingMessage(received, "offerer", "offer"); err != nil {
+		return err
+	}
+	err = answerer.Send("offerer", "answer", map[string]string{"sdp": "answer"})
+	if err != nil {
+		return err
+	}
+	received, err = offerer.Receive(0)
+	if err != nil {
+		return err
+	}
+	if err = checkSignalingMessage(received, "answerer", "answer"); err != nil {
+		return err
+	}
+
+	messages, err := server.Log()
+	if err != nil {
+		return err
+	}
+	for _, expected := range [][2]string{{"offerer", "offer"}, {"answerer", "answer"}} {
+		if err = checkSignalingMessage(messages, expected[0], expected[1]); err != nil {
+			return err
+		}
+	}
+	t.Metric("signaling_messages", float64(len(messages)))
+	return nil
+}
@@ -0,0 +1,9 @@
+module github.com/seppo0010/vortices/signaling
+
+go 1.13
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/stretchr/testify v1.4.0
+	golang.org/x/net v0.0.0-20190628185345-da137c7871d7
+)
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	logPath := flag.String("log", "/var/log/vortices-signaling.jsonl", "file every message is appended to")
+	flag.Parse()
+
+	f, err := os.OpenFile(*logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+	defer f.Close()
+	http.Handle("/rooms/", newServer(f))
+	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"ok"}`))
+	})
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
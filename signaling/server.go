@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const pollTimeout = 25 * time.Second
+
+type message struct {
+	ID      int             `json:"id"`
+	Time    time.Time       `json:"time"`
+	Room    string          `json:"room"`
+	From    string          `json:"from"`
+	To      string          `json:"to,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+func (m *message) visibleTo(peer string) bool {
+	return m.From != peer && (m.To == "" || m.To == peer)
+}
+
+type room struct {
+	messages []*message
+	changed  chan struct{}
+}
+
+type server struct {
+	mu    sync.Mutex
+	rooms map[string]*room
+	log   io.Writer
+}
+
+func newServer(log io.Writer) *server {
+	return &server{rooms: map[string]*room{}, log: log}
+}
+
+func (s *server) room(name string) *room {
+	r, found := s.rooms[name]
+	if !found {
+		r = &room{changed: make(chan struct{})}
+		s.rooms[name] = r
+	}
+	return r
+}
+
+func (s *server) post(roomName string, m *message) error {
+	if m.From == "" || m.Type == "" {
+		return errors.New("messages need a from and a type")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.room(roomName)
+	m.ID = len(r.messages) + 1
+	m.Time = time.Now().UTC()
+	m.Room = roomName
+	r.messages = append(r.messages, m)
+	close(r.changed)
+	r.changed = make(chan struct{})
+	if s.log != nil {
+		data, err := json.Marshal(m)
+		if err == nil {
+			_, err = s.log.Write(append(data, '\n'))
+		}
+		if err != nil {
+			log.Printf("failed to log message: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// messages returns the messages after the given id for peer, or a channel
+// closed when new messages arrive if there are none.
+func (s *server) messages(roomName, peer string, after int) ([]*message, chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.room(roomName)
+	messages := []*message{}
+	for _, m := range r.messages {
+		if m.ID > after && (peer == "" || m.visibleTo(peer)) {
+			messages = append(messages, m)
+		}
+	}
+	if len(messages) > 0 {
+		return messages, nil
+	}
+	return messages, r.changed
+}
+
+func writeError(w http.ResponseWriter, status int, code string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"code": code, "message": err.Error()},
+	})
+}
+
+// ServeHTTP serves
+//
+//	POST /rooms/<room>/messages          send a message
+//	GET  /rooms/<room>/messages?peer=<p>&after=<id>
+//	                                     long poll the messages for a peer
+//	GET  /rooms/<room>/log               every message in the room
+//	GET  /rooms/<room>/ws?peer=<p>       send and receive over a websocket
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "rooms" || parts[1] == "" {
+		writeError(w, 404, "not-found", errors.New("not found"))
+		return
+	}
+	roomName := parts[1]
+	switch {
+	case parts[2] == "messages" && r.Method == http.MethodPost:
+		m := &message{}
+		if err := json.NewDecoder(r.Body).Decode(m); err != nil {
+			writeError(w, 400, "bad-request", err)
+			return
+		}
+		if err := s.post(roomName, m); err != nil {
+			writeError(w, 400, "bad-request", err)
+			return
+		}
+		json.NewEncoder(w).Encode(m)
+	case parts[2] == "messages" && r.Method == http.MethodGet:
+		peer := r.FormValue("peer")
+		if peer == "" {
+			writeError(w, 400, "bad-request", errors.New("missing peer"))
+			return
+		}
+		after, _ := strconv.Atoi(r.FormValue("after"))
+		messages, changed := s.messages(roomName, peer, after)
+		if changed != nil {
+			select {
+			case <-changed:
+				messages, _ = s.messages(roomName, peer, after)
+			case <-time.After(pollTimeout):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"messages": messages})
+	case parts[2] == "log" && r.Method == http.MethodGet:
+		messages, _ := s.messages(roomName, "", 0)
+		json.NewEncoder(w).Encode(map[string]interface{}{"messages": messages})
+	case parts[2] == "ws":
+		peer := r.FormValue("peer")
+		if peer == "" {
+			writeError(w, 400, "bad-request", errors.New("missing peer"))
+			return
+		}
+		websocket.Handler(func(ws *websocket.Conn) {
+			s.serveWebSocket(ws, roomName, peer)
+		}).ServeHTTP(w, r)
+	default:
+		writeError(w, 405, "method-not-allowed", errors.New("method not allowed"))
+	}
+}
+
+func (s *server) serveWebSocket(ws *websocket.Conn, roomName, peer string) {
+	defer ws.Close()
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			m := &message{}
+			if err := websocket.JSON.Receive(ws, m); err != nil {
+				return
+			}
+			m.From = peer
+			if err := s.post(roomName, m); err != nil {
+				log.Printf("dropped message from %s: %s", peer, err.Error())
+			}
+		}
+	}()
+	after := 0
+	for {
+		messages, changed := s.messages(roomName, peer, after)
+		for _, m := range messages {
+			if err := websocket.JSON.Send(ws, m); err != nil {
+				return
+			}
+			after = m.ID
+		}
+		if changed == nil {
+			continue
+		}
+		select {
+		case <-changed:
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+type messagesResponse struct {
+	Messages []*message `json:"messages"`
+}
+
+func postMessage(t *testing.T, url, body string) {
+	res, err := http.Post(url+"/rooms/setup/messages", "application/json", strings.NewReader(body))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	res.Body.Close()
+}
+
+func getMessages(t *testing.T, url string) []*message {
+	res, err := http.Get(url)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	var messages messagesResponse
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&messages))
+	return messages.Messages
+}
+
+func TestRelay(t *testing.T) {
+	var log bytes.Buffer
+	ts := httptest.NewServer(newServer(&log))
+	defer ts.Close()
+
+	postMessage(t, ts.URL, `{"from":"a","type":"offer","payload":{"ufrag":"x"}}`)
+	postMessage(t, ts.URL, `{"from":"b","to":"c","type":"answer"}`)
+
+	messages := getMessages(t, ts.URL+"/rooms/setup/messages?peer=b")
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "offer", messages[0].Type)
+	assert.Equal(t, `{"ufrag":"x"}`, string(messages[0].Payload))
+
+	assert.Len(t, getMessages(t, ts.URL+"/rooms/setup/messages?peer=c"), 2)
+	assert.Len(t, getMessages(t, ts.URL+"/rooms/setup/log"), 2)
+	assert.Len(t, getMessages(t, ts.URL+"/rooms/other/log"), 0)
+	assert.Equal(t, 2, strings.Count(log.String(), `"room":"setup"`))
+
+	done := make(chan []*message)
+	go func() {
+		done <- getMessages(t, ts.URL+"/rooms/setup/messages?peer=b&after=2")
+	}()
+	time.Sleep(50 * time.Millisecond)
+	postMessage(t, ts.URL, `{"from":"a","type":"candidate","payload":"host 10.0.0.2:5000"}`)
+	messages = <-done
+	assert.Len(t, messages, 1)
+	assert.Equal(t, 3, messages[0].ID)
+}
+
+func TestRelayRejectsIncompleteMessages(t *testing.T) {
+	ts := httptest.NewServer(newServer(nil))
+	defer ts.Close()
+	res, err := http.Post(ts.URL+"/rooms/setup/messages", "application/json", strings.NewReader(`{"type":"offer"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 400, res.StatusCode)
+}
+
+func TestRelayWebSocket(t *testing.T) {
+	ts := httptest.NewServer(newServer(nil))
+	defer ts.Close()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/rooms/setup/ws?peer=b"
+	ws, err := websocket.Dial(wsURL, "", ts.URL)
+	assert.Nil(t, err)
+	defer ws.Close()
+
+	postMessage(t, ts.URL, `{"from":"a","type":"offer"}`)
+	m := &message{}
+	assert.Nil(t, websocket.JSON.Receive(ws, m))
+	assert.Equal(t, "a", m.From)
+
+	assert.Nil(t, websocket.JSON.Send(ws, &message{Type: "answer"}))
+	messages := getMessages(t, ts.URL+"/rooms/setup/messages?peer=a")
+	assert.Len(t, messages, 1)
+	assert.Equal(t, "b", messages[0].From)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	dc "github.com/seppo0010/vortices/dockercompose"
+)
+
+func handleSignals(grace time.Duration) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("received %s, stopping running setups (send it again to exit immediately)", sig)
+		go func() {
+			<-signals
+			log.Printf("exiting without stopping running setups")
+			os.Exit(1)
+		}()
+		err := dc.StopAll(grace)
+		if err != nil {
+			log.Printf("%s", err.Error())
+		}
+		code := 128 + int(syscall.SIGINT)
+		if s, ok := sig.(syscall.Signal); ok {
+			code = 128 + int(s)
+		}
+		os.Exit(code)
+	}()
+}
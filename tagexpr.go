@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tagExpr func(tags map[string]bool) bool
+
+type tagExprParser struct {
+	tokens []string
+	pos    int
+}
+
+func tokenizeTagExpr(s string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case strings.HasPrefix(s[i:], "&&"), strings.HasPrefix(s[i:], "||"):
+			tokens = append(tokens, s[i:i+1])
+			i += 2
+		case strings.ContainsRune("&|,!()", c):
+			if c == ',' {
+				c = '|'
+			}
+			tokens = append(tokens, string(c))
+			i++
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '-' || c == '_' || c == '.':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || strings.ContainsRune("-_.", rune(s[j]))) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q in tag expression %q", c, s)
+		}
+	}
+	return tokens, nil
+}
+
+// parseTagExpr parses expressions such as "nat && !slow" or "(turn, ipv6)",
+// where "," and "|" mean or, "&" means and, and "!" negates a tag.
+func parseTagExpr(s string) (tagExpr, error) {
+	tokens, err := tokenizeTagExpr(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &tagExprParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in tag expression %q", p.tokens[p.pos], s)
+	}
+	return expr, nil
+}
+
+func (p *tagExprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *tagExprParser) parseOr() (tagExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "|" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(tags map[string]bool) bool { return l(tags) || right(tags) }
+	}
+	return left, nil
+}
+
+func (p *tagExprParser) parseAnd() (tagExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&" {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(tags map[string]bool) bool { return l(tags) && right(tags) }
+	}
+	return left, nil
+}
+
+func (p *tagExprParser) parseNot() (tagExpr, error) {
+	switch token := p.peek(); token {
+	case "!":
+		p.pos++
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(tags map[string]bool) bool { return !expr(tags) }, nil
+	case "(":
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis in tag expression")
+		}
+		p.pos++
+		return expr, nil
+	case "", "&", "|", ")":
+		return nil, fmt.Errorf("expected a tag in tag expression, got %q", token)
+	default:
+		p.pos++
+		return func(tags map[string]bool) bool { return tags[token] }, nil
+	}
+}
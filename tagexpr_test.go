@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTagExpr(t *testing.T) {
+	tags := map[string]bool{"nat": true, "stun": true}
+	for expr, expected := range map[string]bool{
+		"nat":                  true,
+		"turn":                 false,
+		"!turn":                true,
+		"nat && !stun":         false,
+		"nat & stun":           true,
+		"turn || stun":         true,
+		"turn,ipv6":            false,
+		"!(turn | ipv6) & nat": true,
+		"turn | nat & !stun":   false,
+	} {
+		parsed, err := parseTagExpr(expr)
+		if !assert.Nil(t, err, expr) {
+			continue
+		}
+		assert.Equal(t, expected, parsed(tags), expr)
+	}
+}
+
+func TestParseTagExprErrors(t *testing.T) {
+	for _, expr := range []string{"", "nat &&", "(nat", "nat)", "nat $ stun", "!"} {
+		_, err := parseTagExpr(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/seppo0010/vortices/agent"
+	dc "github.com/seppo0010/vortices/dockercompose"
+)
+
+type testContext struct {
+	context.Context
+	name      string
+	image     string
+	peerImage string
+	router    string
+	signaling string
+	start     dc.StartOptions
+	transport string
+
+	mu         sync.Mutex
+	setups     []*dc.Setup
+	metrics    map[string]float64
+	candidates []candidateObservation
+	pings      []pingObservation
+	pairs      []pairObservation
+	nat        *natOutcome
+	trickle    []trickleTimings
+}
+
+type candidateObservation struct {
+	Computer   string             `json:"computer"`
+	Candidates []*agent.Candidate `json:"candidates"`
+}
+
+type pingObservation struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	RTTs []float64 `json:"rtts_ms"`
+}
+
+type pairObservation struct {
+	Computer string `json:"computer"`
+	Local    string `json:"local"`
+	Remote   string `json:"remote"`
+}
+
+type observations struct {
+	Candidates []candidateObservation `json:"candidates,omitempty"`
+	Pings      []pingObservation      `json:"pings,omitempty"`
+	Pairs      []pairObservation      `json:"selected_pairs,omitempty"`
+	NAT        *natOutcome            `json:"nat,omitempty"`
+	Trickle    []trickleTimings       `json:"trickle,omitempty"`
+}
+
+func newTestContext(ctx context.Context, name, image, router string) *testContext {
+	return &testContext{Context: ctx, name: name, image: image, peerImage: image, router: router, metrics: map[string]float64{}}
+}
+
+func (t *testContext) NewSetup() *dc.Setup {
+	setup := dc.NewSetup()
+	setup.ToolsImage = t.router
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.setups = append(t.setups, setup)
+	return setup
+}
+
+func (t *testContext) StartSetup(setup *dc.Setup) error {
+	return setup.StartWithOptions(t.start)
+}
+
+func (t *testContext) Computer(computer *dc.Computer) *Computer {
+	return &Computer{Computer: computer, test: t}
+}
+
+func (t *testContext) Setups() []*dc.Setup {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*dc.Setup{}, t.setups...)
+}
+
+func (t *testContext) Metric(name string, value float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.metrics[name] = value
+}
+
+func (t *testContext) Metrics() map[string]float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	metrics := map[string]float64{}
+	for name, value := range t.metrics {
+		metrics[name] = value
+	}
+	return metrics
+}
+
+func (t *testContext) RecordCandidates(computer string, candidates []*agent.Candidate) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.candidates = append(t.candidates, candidateObservation{Computer: computer, Candidates: candidates})
+}
+
+func (t *testContext) RecordPing(from, to string, rtts []float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pings = append(t.pings, pingObservation{From: from, To: to, RTTs: rtts})
+}
+
+func (t *testContext) RecordSelectedPair(computer, local, remote string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pairs = append(t.pairs, pairObservation{Computer: computer, Local: local, Remote: remote})
+}
+
+func (t *testContext) RecordNATOutcome(outcome natOutcome) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nat = &outcome
+}
+
+func (t *testContext) RecordTrickleTimings(timings trickleTimings) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.trickle = append(t.trickle, timings)
+}
+
+func (t *testContext) Observations() observations {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return observations{
+		Candidates: append([]candidateObservation{}, t.candidates...),
+		Pings:      append([]pingObservation{}, t.pings...),
+		Pairs:      append([]pairObservation{}, t.pairs...),
+		NAT:        t.nat,
+		Trickle:    append([]trickleTimings{}, t.trickle...),
+	}
+}
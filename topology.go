@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+
+	dc "github.com/seppo0010/vortices/dockercompose"
+)
+
+const (
+	nodeComputer        = "computer"
+	nodeRouter          = "router"
+	nodeSTUNServer      = "stun"
+	nodeSignalingServer = "signaling"
+)
+
+type topologyNode struct {
+	Name     string   `json:"name"`
+	Kind     string   `json:"kind"`
+	Networks []string `json:"networks"`
+	Gateway  string   `json:"gateway,omitempty"`
+}
+
+type topology struct {
+	SetupID  string          `json:"setup_id"`
+	Networks []string        `json:"networks"`
+	Nodes    []*topologyNode `json:"nodes"`
+}
+
+func newTopology(setup *dc.Setup) *topology {
+	shortName := func(name string) string {
+		return strings.TrimPrefix(name, setup.ID+"_")
+	}
+	node := func(comp *dc.BaseComputer, kind string) *topologyNode {
+		n := &topologyNode{Name: shortName(comp.Name), Kind: kind, Networks: []string{}}
+		for _, network := range comp.Networks {
+			n.Networks = append(n.Networks, shortName(network.Name))
+		}
+		return n
+	}
+	t := &topology{SetupID: setup.ID, Networks: []string{}, Nodes: []*topologyNode{}}
+	for _, network := range setup.Networks {
+		t.Networks = append(t.Networks, shortName(network.Name))
+	}
+	for _, computer := range setup.Computers {
+		n := node(computer.BaseComputer, nodeComputer)
+		if computer.Gateway != nil {
+			n.Gateway = shortName(computer.Gateway.Name)
+		}
+		t.Nodes = append(t.Nodes, n)
+	}
+	for _, router := range setup.Routers {
+		t.Nodes = append(t.Nodes, node(router.BaseComputer, nodeRouter))
+	}
+	for _, stun := range setup.STUNServers {
+		t.Nodes = append(t.Nodes, node(stun.BaseComputer, nodeSTUNServer))
+	}
+	for _, server := range setup.SignalingServers {
+		t.Nodes = append(t.Nodes, node(server.BaseComputer, nodeSignalingServer))
+	}
+	return t
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/seppo0010/vortices/agent"
+	dc "github.com/seppo0010/vortices/dockercompose"
+)
+
+const trickleCandidatesWait = time.Second
+
+// trickleTimings are measured by an agent from the call that started its
+// gathering, in milliseconds. Nil means it never happened.
+type trickleTimings struct {
+	Computer       string   `json:"computer"`
+	Role           string   `json:"role"`
+	NAT            string   `json:"nat"`
+	Candidates     int      `json:"candidates"`
+	FirstCandidate *float64 `json:"first_candidate_ms,omitempty"`
+	Srflx          *float64 `json:"srflx_ms,omitempty"`
+	Relay          *float64 `json:"relay_ms,omitempty"`
+	Connected      *float64 `json:"connected_ms,omitempty"`
+}
+
+func init() {
+	for _, kind := range natMatrixKinds {
+		kind := kind
+		registerTest(&Test{
+			Name:        fmt.Sprintf("trickle-ice[%s]", kind),
+			Description: fmt.Sprintf("a peer behind %s NAT trickles its candidates to a peer on the internet while the connectivity checks run", kind),
+			Tags:        []string{tagNAT, tagSTUN, tagTrickle},
+			Requires:    []string{capabilityICE, capabilityTrickleICE},
+			Weight:      natMatrixWeight(kind, natNone),
+			Peers:       2,
+			NAT:         kind,
+			Run: func(t *testContext) error {
+				return testTrickleICE(t, kind)
+			},
+		})
+	}
+}
+
+func milliseconds(seconds float64) *float64 {
+	ms := seconds * 1000
+	return &ms
+}
+
+func newTrickleTimings(events []*agent.ICECandidateEvent, state *agent.ICEState) trickleTimings {
+	timings := trickleTimings{Candidates: len(events)}
+	first := func(current **float64, elapsed float64) {
+		if *current == nil {
+			*current = milliseconds(elapsed)
+		}
+	}
+	for _, event := range events {
+		first(&timings.FirstCandidate, event.Elapsed)
+		switch event.Candidate.Type {
+		case "srflx":
+			first(&timings.Srflx, event.Elapsed)
+		case "relay":
+			first(&timings.Relay, event.Elapsed)
+		}
+	}
+	if state != nil && state.Connected() {
+		timings.Connected = milliseconds(state.ConnectedAfter)
+	}
+	return timings
+}
+
+// relayCandidates forwards the candidates trickled by from to to until from
+// finishes gathering, and returns them in the order they were gathered.
+func relayCandidates(from, to *Computer) ([]*agent.ICECandidateEvent, error) {
+	events := []*agent.ICECandidateEvent{}
+	after := 0
+	for {
+		res, err := from.ICECandidates(after, trickleCandidatesWait)
+		if err != nil {
+			return events, err
+		}
+		if len(res.Candidates) > 0 {
+			candidates := make([]*agent.Candidate, len(res.Candidates))
+			for i, event := range res.Candidates {
+				candidates[i] = event.Candidate
+				after = event.Index
+			}
+			err = to.ICEAddRemoteCandidates(candidates)
+			if err != nil {
+				return events, err
+			}
+			events = append(events, res.Candidates...)
+		}
+		if res.Done {
+			return events, nil
+		}
+		if err := from.test.Err(); err != nil {
+			return events, err
+		}
+	}
+}
+
+// connectTrickleICE is connectICE with the candidates relayed as they are
+// gathered, after the connectivity checks started. It returns the states and
+// the trickled candidates of the offerer and the answerer, in that order.
+func connectTrickleICE(offerer, answerer *Computer, opts agent.GatherOptions, timeout time.Duration) ([]*agent.ICEState, [][]*agent.ICECandidateEvent, error) {
+	opts.Trickle = true
+	_, err := startICE(offerer, answerer, opts, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	peers := []*Computer{offerer, answerer}
+	events := make([][]*agent.ICECandidateEvent, len(peers))
+	errs := make([]error, len(peers))
+	var wg sync.WaitGroup
+	for i := range peers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			events[i], errs[i] = relayCandidates(peers[i], peers[1-i])
+		}(i)
+	}
+	states, err := waitICE(peers, timeout)
+	wg.Wait()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return states, events, nil
+}
+
+func testTrickleICE(t *testContext, kind string) (err error) {
+	setup := t.NewSetup()
+	internet := setup.NewNetwork("internet")
+	setup.NewSTUNServer("stun-server", []*dc.Network{internet})
+	peers := []*Computer{
+		newNATPeer(t, setup, "computer", t.image, kind, internet),
+		t.Computer(setup.NewComputer("computer2", t.peerImage, nil, []*dc.Network{internet})),
+	}
+	err = t.StartSetup(setup)
+	if err != nil {
+		return err
+	}
+	defer teardown(setup, &err)
+	servers, err := iceServers(setup)
+	if err != nil {
+		return err
+	}
+	states, events, err := connectTrickleICE(peers[0], peers[1], servers, natMatrixConnectTimeout)
+	if err != nil {
+		return err
+	}
+
+	for i, role := range []string{"offerer", "answerer"} {
+		timings := newTrickleTimings(events[i], states[i])
+		timings.Computer, timings.Role, timings.NAT = peers[i].Name, role, natNone
+		if i == 0 {
+			timings.NAT = kind
+		}
+		t.RecordTrickleTimings(timings)
+		for name, value := range map[string]*float64{
+			"time_to_first_candidate_ms": timings.FirstCandidate,
+			"time_to_srflx_ms":           timings.Srflx,
+			"time_to_relay_ms":           timings.Relay,
+			"time_to_connected_ms":       timings.Connected,
+		} {
+			if value != nil {
+				t.Metric(role+"."+name, *value)
+			}
+		}
+		if timings.Candidates == 0 {
+			return fmt.Errorf("%s did not trickle any candidate", peers[i].Name)
+		}
+	}
+	connected := states[0].Connected() && states[1].Connected()
+	if expected, found := expectedNATMatrix[natMatrixKey(kind, natNone)]; found && expected && !connected {
+		return fmt.Errorf("peers did not connect with trickle ICE: states %s and %s", states[0].State, states[1].State)
+	}
+	return nil
+}
+
+type trickleRow struct {
+	trickleTimings
+	Peers  string `json:"peers"`
+	Status string `json:"status"`
+}
+
+func (r *trickleRow) Cells() []string {
+	cells := []string{r.NAT, r.Role, fmt.Sprint(r.Candidates)}
+	for _, ms := range []*float64{r.FirstCandidate, r.Srflx, r.Relay, r.Connected} {
+		cell := "-"
+		if ms != nil {
+			cell = fmt.Sprintf("%.0f", *ms)
+		}
+		cells = append(cells, cell)
+	}
+	return cells
+}
+
+func natKindIndex(kind string) int {
+	for i, k := range natMatrixKinds {
+		if k == kind {
+			return i
+		}
+	}
+	return len(natMatrixKinds)
+}
+
+// sortTrickleRows orders the rows by peers, then NAT type as in the NAT
+// matrix, offerer first.
+func sortTrickleRows(rows []trickleRow) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.Peers != b.Peers {
+			return a.Peers < b.Peers
+		}
+		if a.NAT != b.NAT {
+			return natKindIndex(a.NAT) < natKindIndex(b.NAT)
+		}
+		return a.Role > b.Role
+	})
+}
+
+func printTrickleTimings(w io.Writer, rows []trickleRow) {
+	rows = append([]trickleRow{}, rows...)
+	sortTrickleRows(rows)
+	var tw *tabwriter.Writer
+	for i, row := range rows {
+		if i == 0 || row.Peers != rows[i-1].Peers {
+			if tw != nil {
+				tw.Flush()
+			}
+			fmt.Fprintf(w, "\nTrickle ICE (%s), ms from the start of gathering, - never happened\n", row.Peers)
+			tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "NAT\tROLE\tCANDIDATES\tFIRST\tSRFLX\tRELAY\tCONNECTED")
+		}
+		fmt.Fprintln(tw, strings.Join(row.Cells(), "\t"))
+	}
+	if tw != nil {
+		tw.Flush()
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/seppo0010/vortices/agent"
+	"github.com/stretchr/testify/assert"
+)
+
+func ms(v float64) *float64 {
+	return &v
+}
+
+func TestNewTrickleTimings(t *testing.T) {
+	events := []*agent.ICECandidateEvent{
+		{Index: 1, Elapsed: 0.005, Candidate: &agent.Candidate{Type: "host"}},
+		{Index: 2, Elapsed: 0.12, Candidate: &agent.Candidate{Type: "srflx"}},
+		{Index: 3, Elapsed: 0.13, Candidate: &agent.Candidate{Type: "srflx"}},
+	}
+	timings := newTrickleTimings(events, &agent.ICEState{State: agent.ICEStateConnected, ConnectedAfter: 0.3})
+	assert.Equal(t, trickleTimings{Candidates: 3, FirstCandidate: ms(5), Srflx: ms(120), Connected: ms(300)}, timings)
+
+	// a candidate gathered right away is not mistaken for none
+	events = []*agent.ICECandidateEvent{
+		{Index: 1, Elapsed: 0, Candidate: &agent.Candidate{Type: "host"}},
+		{Index: 2, Elapsed: 0.01, Candidate: &agent.Candidate{Type: "host"}},
+	}
+	timings = newTrickleTimings(events, &agent.ICEState{State: agent.ICEStateConnected})
+	assert.Equal(t, trickleTimings{Candidates: 2, FirstCandidate: ms(0), Connected: ms(0)}, timings)
+
+	timings = newTrickleTimings(nil, &agent.ICEState{State: agent.ICEStateFailed, ConnectedAfter: 1})
+	assert.Equal(t, trickleTimings{}, timings)
+}
+
+func TestPrintTrickleTimings(t *testing.T) {
+	var out bytes.Buffer
+	printTrickleTimings(&out, []trickleRow{
+		{trickleTimings: trickleTimings{NAT: "none", Role: "answerer", Candidates: 1, FirstCandidate: ms(3), Connected: ms(410)}, Peers: "pion,pion"},
+		{trickleTimings: trickleTimings{NAT: "symmetric", Role: "offerer", Candidates: 2, FirstCandidate: ms(4), Srflx: ms(95.6)}, Peers: "pion,pion"},
+		{trickleTimings: trickleTimings{NAT: "none", Role: "offerer", Candidates: 1, FirstCandidate: ms(0), Connected: ms(400)}, Peers: "pion,pion"},
+	})
+	assert.Equal(t, `
+Trickle ICE (pion,pion), ms from the start of gathering, - never happened
+NAT        ROLE      CANDIDATES  FIRST  SRFLX  RELAY  CONNECTED
+none       offerer   1           0      -      -      400
+none       answerer  1           3      -      -      410
+symmetric  offerer   2           4      96     -      -
+`, out.String())
+}